@@ -1,9 +1,11 @@
 package config
 
 import (
+	"errors"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 
 	"gopkg.in/yaml.v3"
 )
@@ -11,12 +13,23 @@ import (
 var conf *Configure
 var WorkDirInRootfs, WorkDirGlobal, WorkUser string
 var DataFilesPath, CacheFilesPath string
+var MaxTimeLimit int32
+var MaxMemoryLimit int64
+var RootfsIdentity string
+var CompileCacheSize, DataCacheSize, MemoryCacheSize int64
+var MemoryCachePath string
+var Languages map[string]LanguageConfig
+var DataSource DataSourceConfig
 
 type Configure struct {
-	Rootfs         RootfsConfig `yaml:"rootfs"`
-	MQ             MQConfig     `yaml:"mq"`
-	DataFilesPath  string       `yaml:"dataFilesPath"`
-	CacheFilesPath string       `yaml:"cacheFilesPath"`
+	Rootfs         RootfsConfig              `yaml:"rootfs"`
+	MQ             MQConfig                  `yaml:"mq"`
+	Limits         LimitsConfig              `yaml:"limits"`
+	Cache          CacheConfig               `yaml:"cache"`
+	Languages      map[string]LanguageConfig `yaml:"languages"`
+	DataSource     DataSourceConfig          `yaml:"dataSource"`
+	DataFilesPath  string                    `yaml:"dataFilesPath"`
+	CacheFilesPath string                    `yaml:"cacheFilesPath"`
 }
 
 type RootfsConfig struct {
@@ -24,6 +37,7 @@ type RootfsConfig struct {
 	ContainerFilesPath string `yaml:"containerFilesPath"`
 	WorkDir            string `yaml:"workDir"`
 	WorkUser           string `yaml:"workUser"`
+	Identity           string `yaml:"identity"`
 }
 
 type MQConfig struct {
@@ -34,6 +48,49 @@ type MQConfig struct {
 	QueueName string `yaml:"queueName"`
 }
 
+// The largest limits a request may ask for
+type LimitsConfig struct {
+	Time   int32 `yaml:"time"`
+	Memory int64 `yaml:"memory"`
+}
+
+// How the worker builds and runs programs shipped with problems, e.g. checkers.
+// The program is saved as Source, Exec is the artifact to keep. Extensions
+// pick the language of programs in problem packages, e.g. ".cpp".
+type LanguageConfig struct {
+	Source     string     `yaml:"source"`
+	Compile    [][]string `yaml:"compile"`
+	Exec       string     `yaml:"exec"`
+	Run        []string   `yaml:"run"`
+	Extensions []string   `yaml:"extensions"`
+}
+
+// Sizes are in bytes, 0 disables the compile cache. DataSize bounds the
+// extracted data archives, 0 means no limit. MemorySize is the budget of the
+// test data kept in MemoryPath, which must be a tmpfs, 0 disables it.
+type CacheConfig struct {
+	CompileSize int64  `yaml:"compileSize"`
+	DataSize    int64  `yaml:"dataSize"`
+	MemorySize  int64  `yaml:"memorySize"`
+	MemoryPath  string `yaml:"memoryPath"`
+}
+
+// Where problems come from. Type is local, http or s3; the remote ones fetch
+// URL/<problemID>/manifest.json and the files it lists on first use and keep
+// at most CacheSize bytes of problems, 0 means no limit. s3 signs requests
+// with the keys, URL is path style, e.g. http://minio:9000/bucket/problems.
+// The manifest of a cached problem is checked again once it is ManifestTTL
+// seconds old, 0 means before every use.
+type DataSourceConfig struct {
+	Type        string `yaml:"type"`
+	URL         string `yaml:"url"`
+	Region      string `yaml:"region"`
+	AccessKey   string `yaml:"accessKey"`
+	SecretKey   string `yaml:"secretKey"`
+	CacheSize   int64  `yaml:"cacheSize"`
+	ManifestTTL int64  `yaml:"manifestTTL"`
+}
+
 func InitConfig(filePath *string) {
 	fileBytes, err := os.ReadFile(*filePath)
 	if err != nil {
@@ -47,7 +104,56 @@ func InitConfig(filePath *string) {
 	WorkDirInRootfs = conf.Rootfs.WorkDir
 	WorkUser = conf.Rootfs.WorkUser
 	WorkDirGlobal = filepath.Join(conf.Rootfs.RootfsPath, WorkDirInRootfs)
+	RootfsIdentity = conf.Rootfs.Identity
+	if RootfsIdentity == "" {
+		RootfsIdentity = conf.Rootfs.RootfsPath
+	}
 	DataFilesPath = conf.DataFilesPath
 	CacheFilesPath = conf.CacheFilesPath
+	CompileCacheSize = conf.Cache.CompileSize
+	DataCacheSize = conf.Cache.DataSize
+	MemoryCacheSize = conf.Cache.MemorySize
+	MemoryCachePath = conf.Cache.MemoryPath
+	if MemoryCachePath == "" {
+		MemoryCachePath = DefaultMemoryCachePath
+	}
+	Languages = conf.Languages
+	for name, lang := range Languages {
+		for _, args := range lang.Compile {
+			if len(args) == 0 {
+				log.Println("[FAILED] language " + name + " has an empty compile command")
+				panic(errors.New("empty compile command of language " + name))
+			}
+		}
+	}
+	DataSource = conf.DataSource
+	if DataSource.Type == "" {
+		DataSource.Type = DataSourceLocal
+	}
+	MaxTimeLimit = conf.Limits.Time
+	if MaxTimeLimit <= 0 {
+		MaxTimeLimit = DefaultMaxTimeLimit
+	}
+	MaxMemoryLimit = conf.Limits.Memory
+	if MaxMemoryLimit <= 0 {
+		MaxMemoryLimit = DefaultMaxMemoryLimit
+	}
 	log.Println("[INFO] Init config successfully")
 }
+
+// LanguageByExtension returns the first language by name which claims ext
+func LanguageByExtension(ext string) (string, bool) {
+	names := make([]string, 0, len(Languages))
+	for name := range Languages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, e := range Languages[name].Extensions {
+			if e == ext {
+				return name, true
+			}
+		}
+	}
+	return "", false
+}
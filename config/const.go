@@ -1,12 +1,53 @@
 package config
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var ErrTLE = errors.New("time limit exceeded")
 var ErrOOM = errors.New("out of memory")
 var ErrFile = errors.New("file operation with no permission")
+var ErrInvalidRequest = errors.New("invalid request")
+var ErrProblemData = errors.New("problem data error")
 
 const FolderNameLen = 20
 const OmitStringLen = int64(4096)
+const MaxLogLimit = int64(1 << 20)
+
+const DefaultMaxTimeLimit = int32(10000)
+const DefaultMaxMemoryLimit = int64(1024 << 20)
+
+const ToolTimeLimit = int32(10000)
+const ToolMemoryLimit = int64(1024 << 20)
+
+// Problems loaded at a time, loading runs validators, generators and tool builds
+const LoadProblemWorkers = 4
+
+const CheckerTypeTestlib = "testlib"
+const CheckerTypeKattis = "kattis"
+const KattisExitAC = 42
+const KattisExitWA = 43
+
+const InvalidInputReject = "reject"
+const InvalidInputWarn = "warn"
+
+const DefaultMemoryCachePath = "/dev/shm/cdoj-execution-worker"
+
+const DataSourceLocal = "local"
+const DataSourceHTTP = "http"
+const DataSourceS3 = "s3"
+const DataSourceTimeout = 10 * time.Minute
+
+const CheckMethodWcmp = "wcmp"
+const CheckMethodSpj = "spj"
+
+const MaxCompileSteps = 16
+
+const MaxSourceFileSize = int64(1 << 20)
+const MaxSourceTotalSize = int64(16 << 20)
+const MaxSourceFiles = 1024
+const MaxFileNameLen = 255
+const MaxPathLen = 4096
 
 var DefaultEnv = []string{"PATH=/bin:/usr/bin"}
@@ -0,0 +1,62 @@
+package diag
+
+import (
+	"strings"
+
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+)
+
+const MaxDiagnostics = 256
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityNote    = "note"
+)
+
+// Parser extracts diagnostics from the output of a compiler
+type Parser func(log string) []model.Diagnostic
+
+var parsers = map[string]Parser{
+	"gcc":    ParseGCC,
+	"clang":  ParseGCC,
+	"javac":  ParseJavac,
+	"rustc":  ParseRustc,
+	"python": ParsePython,
+}
+
+func Register(name string, parser Parser) {
+	parsers[name] = parser
+}
+
+func Known(name string) bool {
+	_, ok := parsers[name]
+	return ok
+}
+
+// Parse returns nil if no parser is registered as name
+func Parse(name string, log string) []model.Diagnostic {
+	parser, ok := parsers[name]
+	if !ok {
+		return nil
+	}
+	res := parser(log)
+	if len(res) > MaxDiagnostics {
+		res = res[:MaxDiagnostics]
+	}
+	return res
+}
+
+func lines(log string) []string {
+	return strings.Split(strings.ReplaceAll(log, "\r\n", "\n"), "\n")
+}
+
+func severity(s string) string {
+	switch {
+	case strings.Contains(s, "error"):
+		return SeverityError
+	case strings.Contains(s, "warning"):
+		return SeverityWarning
+	}
+	return SeverityNote
+}
@@ -0,0 +1,160 @@
+package diag
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/goccy/go-json"
+)
+
+var gccRegexp = regexp.MustCompile(`^(.+?):(\d+):(?:(\d+):)? (fatal error|error|warning|note): (.*)$`)
+var javacRegexp = regexp.MustCompile(`^(.+\.java):(\d+): (error|warning): (.*)$`)
+var rustcHeadRegexp = regexp.MustCompile(`^(error|warning)(?:\[\w+\])?: (.*)$`)
+var rustcLocRegexp = regexp.MustCompile(`^\s*--> (.+):(\d+):(\d+)$`)
+var pythonLocRegexp = regexp.MustCompile(`^\s*File "(.+)", line (\d+)`)
+var pythonErrRegexp = regexp.MustCompile(`^([A-Za-z_][\w.]*(?:Error|Exception|Warning))(?:: (.*))?$`)
+
+type gccLocation struct {
+	Caret struct {
+		File   string `json:"file"`
+		Line   int    `json:"line"`
+		Column int    `json:"column"`
+	} `json:"caret"`
+}
+
+type gccJSONDiagnostic struct {
+	Kind      string              `json:"kind"`
+	Message   string              `json:"message"`
+	Locations []gccLocation       `json:"locations"`
+	Children  []gccJSONDiagnostic `json:"children"`
+}
+
+func flattenGCCJSON(diags []gccJSONDiagnostic, res []model.Diagnostic) []model.Diagnostic {
+	for _, d := range diags {
+		diagnostic := model.Diagnostic{
+			Severity: severity(d.Kind),
+			Message:  d.Message,
+		}
+		if len(d.Locations) != 0 {
+			diagnostic.File = d.Locations[0].Caret.File
+			diagnostic.Line = d.Locations[0].Caret.Line
+			diagnostic.Column = d.Locations[0].Caret.Column
+		}
+		res = append(res, diagnostic)
+		res = flattenGCCJSON(d.Children, res)
+	}
+	return res
+}
+
+// ParseGCC understands both the text format and -fdiagnostics-format=json
+func ParseGCC(log string) []model.Diagnostic {
+	res := make([]model.Diagnostic, 0)
+	if trimmed := strings.TrimSpace(log); strings.HasPrefix(trimmed, "[") {
+		diags := make([]gccJSONDiagnostic, 0)
+		if err := json.Unmarshal([]byte(trimmed), &diags); err == nil {
+			return flattenGCCJSON(diags, res)
+		}
+	}
+	for _, line := range lines(log) {
+		m := gccRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		column, _ := strconv.Atoi(m[3])
+		res = append(res, model.Diagnostic{
+			File:     m[1],
+			Line:     lineNo,
+			Column:   column,
+			Severity: severity(m[4]),
+			Message:  m[5],
+		})
+	}
+	return res
+}
+
+func ParseJavac(log string) []model.Diagnostic {
+	res := make([]model.Diagnostic, 0)
+	ls := lines(log)
+	for i, line := range ls {
+		m := javacRegexp.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		column := 0
+		// javac prints the source line and a caret under the column
+		if i+2 < len(ls) && strings.TrimSpace(ls[i+2]) == "^" {
+			column = strings.Index(ls[i+2], "^") + 1
+		}
+		res = append(res, model.Diagnostic{
+			File:     m[1],
+			Line:     lineNo,
+			Column:   column,
+			Severity: severity(m[3]),
+			Message:  m[4],
+		})
+	}
+	return res
+}
+
+// ParseRustc ignores messages without a location such as "aborting due to previous error"
+func ParseRustc(log string) []model.Diagnostic {
+	res := make([]model.Diagnostic, 0)
+	ls := lines(log)
+	for i, line := range ls {
+		m := rustcHeadRegexp.FindStringSubmatch(line)
+		if m == nil || i+1 >= len(ls) {
+			continue
+		}
+		loc := rustcLocRegexp.FindStringSubmatch(ls[i+1])
+		if loc == nil {
+			continue
+		}
+		lineNo, _ := strconv.Atoi(loc[2])
+		column, _ := strconv.Atoi(loc[3])
+		res = append(res, model.Diagnostic{
+			File:     loc[1],
+			Line:     lineNo,
+			Column:   column,
+			Severity: severity(m[1]),
+			Message:  m[2],
+		})
+	}
+	return res
+}
+
+// ParsePython reports the innermost frame of every traceback
+func ParsePython(log string) []model.Diagnostic {
+	res := make([]model.Diagnostic, 0)
+	var last *model.Diagnostic
+	for _, line := range lines(log) {
+		if m := pythonLocRegexp.FindStringSubmatch(line); m != nil {
+			lineNo, _ := strconv.Atoi(m[2])
+			last = &model.Diagnostic{File: m[1], Line: lineNo}
+			continue
+		}
+		if last == nil {
+			continue
+		}
+		// the source line is indented by 4 spaces, so is the caret
+		if trimmed := strings.TrimSpace(line); trimmed != "" && strings.Trim(trimmed, "^~") == "" {
+			if idx := strings.Index(line, "^"); idx >= 4 {
+				last.Column = idx - 3
+			}
+			continue
+		}
+		if m := pythonErrRegexp.FindStringSubmatch(line); m != nil {
+			last.Severity = SeverityError
+			if strings.HasSuffix(m[1], "Warning") {
+				last.Severity = SeverityWarning
+			}
+			last.Message = strings.TrimSuffix(m[1]+": "+m[2], ": ")
+			res = append(res, *last)
+			last = nil
+		}
+	}
+	return res
+}
@@ -0,0 +1,99 @@
+package diag_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/HeRaNO/cdoj-execution-worker/diag"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+)
+
+func check(t *testing.T, parser string, log string, want []model.Diagnostic) {
+	t.Helper()
+	got := diag.Parse(parser, log)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("%s: expected %+v, got %+v", parser, want, got)
+	}
+}
+
+func TestParseGCC(t *testing.T) {
+	log := `main.cpp: In function 'int main()':
+main.cpp:5:5: error: 'x' was not declared in this scope
+    5 |     x = 1;
+      |     ^
+main.cpp:3:9: warning: unused variable 'a' [-Wunused-variable]
+In file included from main.cpp:1:
+lib.h:2: error: expected ';' before '}' token
+`
+	check(t, "gcc", log, []model.Diagnostic{
+		{File: "main.cpp", Line: 5, Column: 5, Severity: "error", Message: "'x' was not declared in this scope"},
+		{File: "main.cpp", Line: 3, Column: 9, Severity: "warning", Message: "unused variable 'a' [-Wunused-variable]"},
+		{File: "lib.h", Line: 2, Severity: "error", Message: "expected ';' before '}' token"},
+	})
+}
+
+func TestParseGCCJSON(t *testing.T) {
+	log := `[{"kind": "error", "message": "expected ';' before '}' token",
+  "locations": [{"caret": {"file": "main.c", "line": 4, "column": 12}}],
+  "children": [{"kind": "note", "message": "declared here",
+    "locations": [{"caret": {"file": "main.c", "line": 2, "column": 5}}]}]}]`
+	check(t, "gcc", log, []model.Diagnostic{
+		{File: "main.c", Line: 4, Column: 12, Severity: "error", Message: "expected ';' before '}' token"},
+		{File: "main.c", Line: 2, Column: 5, Severity: "note", Message: "declared here"},
+	})
+}
+
+func TestParseJavac(t *testing.T) {
+	log := `Main.java:3: error: cannot find symbol
+        System.out.println(x);
+                           ^
+  symbol:   variable x
+  location: class Main
+1 error
+`
+	check(t, "javac", log, []model.Diagnostic{
+		{File: "Main.java", Line: 3, Column: 28, Severity: "error", Message: "cannot find symbol"},
+	})
+}
+
+func TestParseRustc(t *testing.T) {
+	log := `error[E0425]: cannot find value ` + "`x`" + ` in this scope
+ --> src/main.rs:2:20
+  |
+2 |     println!("{}", x);
+  |                    ^ not found in this scope
+
+error: aborting due to previous error
+`
+	check(t, "rustc", log, []model.Diagnostic{
+		{File: "src/main.rs", Line: 2, Column: 20, Severity: "error", Message: "cannot find value `x` in this scope"},
+	})
+}
+
+func TestParsePython(t *testing.T) {
+	log := `  File "main.py", line 1
+    print("a"
+         ^
+SyntaxError: '(' was never closed
+`
+	check(t, "python", log, []model.Diagnostic{
+		{File: "main.py", Line: 1, Column: 6, Severity: "error", Message: "SyntaxError: '(' was never closed"},
+	})
+
+	log = `Traceback (most recent call last):
+  File "/usr/lib/python3.10/py_compile.py", line 144, in compile
+    code = loader.source_to_code(source_bytes, dfile or file,
+  File "main.py", line 2
+    return 1
+IndentationError: unexpected indent
+`
+	check(t, "python", log, []model.Diagnostic{
+		{File: "main.py", Line: 2, Severity: "error", Message: "IndentationError: unexpected indent"},
+	})
+}
+
+func TestParseUnknown(t *testing.T) {
+	if diag.Known("brainfuck") || diag.Parse("brainfuck", "error") != nil {
+		t.Error("unknown parser should produce nothing")
+	}
+}
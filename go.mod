@@ -2,6 +2,8 @@ module github.com/HeRaNO/cdoj-execution-worker
 
 go 1.21.9
 
+replace github.com/HeRaNO/cdoj-execution-worker/model => ./model
+
 require (
 	github.com/HeRaNO/cdoj-execution-worker/model v0.1.0
 	github.com/goccy/go-json v0.10.3
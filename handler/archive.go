@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+)
+
+// The data archives a problem folder may have, the first one found is used
+var dataArchiveNames = []string{"data.zip", "data.tar.zst", "data.tar.gz", "data.tar"}
+
+// Extracted data archives are kept by the path, size and modification time of the archive
+var dataCache *util.DirCache
+
+func dataCacheRoot() string {
+	return filepath.Join(config.CacheFilesPath, "data")
+}
+
+func initDataCache() {
+	cache, err := util.NewDirCache(dataCacheRoot(), config.DataCacheSize)
+	if err != nil {
+		util.ErrorLog(err, "initDataCache()")
+		panic(err)
+	}
+	dataCache = cache
+}
+
+func findDataArchive(problemPath string) string {
+	for _, name := range dataArchiveNames {
+		archivePath := filepath.Join(problemPath, name)
+		if fileExists(archivePath) {
+			return archivePath
+		}
+	}
+	return ""
+}
+
+// archiveTestCaseNames sets dataKey and lists the files at the top of the archive
+func (p *Problem) archiveTestCaseNames() ([]string, error) {
+	stat, err := os.Stat(p.Archive)
+	if err != nil {
+		return nil, err
+	}
+	p.dataKey = util.HashKey(struct {
+		Path    string
+		Size    int64
+		ModTime int64
+	}{p.Archive, stat.Size(), stat.ModTime().UnixNano()})
+
+	entries, err := util.ArchiveEntries(p.Archive)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, name := range entries {
+		if !strings.Contains(name, "/") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// holdData extracts the data archive when it is not cached and keeps it until
+// release is called
+func (p *Problem) holdData() (func(), error) {
+	if p.Archive == "" {
+		return func() {}, nil
+	}
+	_, release, err := dataCache.HoldOrPut(p.dataKey, func(dir string) error {
+		w := util.SourceWriter{Dir: dir, Unlimited: true}
+		return w.ExtractFile(p.Archive)
+	})
+	if err != nil {
+		util.ErrorLog(err, "holdData(): extract "+p.Archive)
+		return nil, err
+	}
+	return release, nil
+}
@@ -0,0 +1,124 @@
+package handler_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/handler"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"golang.org/x/sys/unix"
+)
+
+func TestKattisResult(t *testing.T) {
+	dir := t.TempDir()
+	outside := t.TempDir()
+	writeFiles(t, dir, map[string]string{"feedback/judgemessage.txt": "expected 3, got 4"})
+	writeFiles(t, outside, map[string]string{"secret": "root:x:0:0", "judgemessage.txt": "root:x:0:0"})
+	if err := os.Symlink(filepath.Join(outside, "secret"), filepath.Join(dir, "feedback", "teammessage.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := handler.KattisResult(config.KattisExitAC, nil, dir, "feedback", config.OmitStringLen)
+	if err != nil || !res.Accepted {
+		t.Fatalf("42 should accept: %+v, %v", res, err)
+	}
+	res, err = handler.KattisResult(config.KattisExitWA, nil, dir, "feedback", 8)
+	if err != nil || res.Accepted {
+		t.Fatalf("43 should reject: %+v, %v", res, err)
+	}
+	if res.JudgeMessage == nil || res.JudgeMessage.S != "expected" || res.JudgeMessage.OmitSize != 9 {
+		t.Errorf("judge message should be read up to the limit: %+v", res.JudgeMessage)
+	}
+	if res.TeamMessage != nil {
+		t.Errorf("linked team message should not be read: %+v", res.TeamMessage)
+	}
+	if _, err = handler.KattisResult(0, nil, dir, "feedback", config.OmitStringLen); err == nil {
+		t.Error("other exit codes should be an error")
+	}
+	_, err = handler.KattisResult(137, config.ErrTLE, dir, "feedback", config.OmitStringLen)
+	if err == nil || !strings.Contains(err.Error(), config.ErrTLE.Error()) {
+		t.Errorf("time limit of the validator should be reported: %v", err)
+	}
+
+	os.RemoveAll(filepath.Join(dir, "feedback"))
+	if err = os.Symlink(outside, filepath.Join(dir, "feedback")); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = handler.KattisResult(config.KattisExitWA, nil, dir, "feedback", config.OmitStringLen); err != nil {
+		t.Fatal(err)
+	}
+	if res.JudgeMessage != nil {
+		t.Errorf("linked feedback directory should not be read: %+v", res.JudgeMessage)
+	}
+}
+
+func TestCheckerConfig(t *testing.T) {
+	c := (&handler.Problem{}).CheckerConfig()
+	if c.Type != config.CheckerTypeTestlib || c.Limits.Time != config.ToolTimeLimit || c.Limits.Memory != config.ToolMemoryLimit {
+		t.Errorf("unexpected defaults %+v", c)
+	}
+	if args := strings.Join(c.RunArgs([]string{"./checker"}), " "); args != "./checker input user_out answer" {
+		t.Errorf("testlib args are %q", args)
+	}
+
+	p := &handler.Problem{Judge: handler.JudgeConfig{Checker: &handler.CheckerConfig{Type: config.CheckerTypeKattis}}}
+	c = p.CheckerConfig()
+	if args := strings.Join(c.RunArgs([]string{"./checker"}), " "); args != "./checker input answer feedback/" {
+		t.Errorf("kattis args are %q", args)
+	}
+
+	p.Judge.Checker = &handler.CheckerConfig{
+		Args:   []string{"{input}", "-e", "{output}.{answer}"},
+		Files:  handler.CheckerFiles{Input: "in.txt"},
+		Limits: config.LimitsConfig{Time: 500},
+	}
+	c = p.CheckerConfig()
+	if args := strings.Join(c.RunArgs([]string{"python3", "check.py"}), " "); args != "python3 check.py in.txt -e user_out.answer" {
+		t.Errorf("placeholders should be replaced, got %q", args)
+	}
+	if c.Limits.Time != 500 || c.Limits.Memory != config.ToolMemoryLimit || c.Files.Feedback != handler.DefaultCheckerFiles.Feedback {
+		t.Errorf("settings should be kept and the rest filled: %+v", c)
+	}
+}
+
+func TestCheckerMounts(t *testing.T) {
+	programDir := t.TempDir()
+	writeFiles(t, programDir, map[string]string{"checker": "", "checker.py": ""})
+	programs, err := handler.ProgramMounts(programDir, "/work/c")
+	if err != nil || len(programs) != 2 {
+		t.Fatalf("programs are %v, %v", programs, err)
+	}
+	for _, m := range programs {
+		if m.Flags&unix.MS_RDONLY == 0 || m.Flags&unix.MS_NOEXEC != 0 || filepath.Dir(m.Destination) != "/work/c" {
+			t.Errorf("program should be bound read-only and executable: %+v", m)
+		}
+	}
+
+	c := (&handler.Problem{}).CheckerConfig()
+	c.SetMounts(programs)
+	testCase := model.TestCase{Input: "/data/1.in", Output: "/data/1.ans"}
+	mounts := handler.CheckerMounts(c, testCase, "/tmp/out", "/work/c")
+	want := map[string]string{"/work/c/input": "/data/1.in", "/work/c/answer": "/data/1.ans", "/work/c/user_out": "/tmp/out"}
+	if len(mounts) != len(programs)+len(want) {
+		t.Fatalf("unexpected mounts %+v", mounts)
+	}
+	for _, m := range mounts[len(programs):] {
+		if want[m.Destination] != m.Source {
+			t.Errorf("unexpected mount %s at %s", m.Source, m.Destination)
+		}
+		if m.Flags&(unix.MS_RDONLY|unix.MS_NOEXEC|unix.MS_NOSUID) != unix.MS_RDONLY|unix.MS_NOEXEC|unix.MS_NOSUID {
+			t.Errorf("%s should be read-only and not executable: %#x", m.Destination, m.Flags)
+		}
+	}
+
+	c.Type = config.CheckerTypeKattis
+	mounts = handler.CheckerMounts(c, testCase, "/tmp/out", "/work/c")
+	for _, m := range mounts {
+		if m.Source == "/tmp/out" {
+			t.Error("kattis validators read the user output from stdin, not a mount")
+		}
+	}
+}
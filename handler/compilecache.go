@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+	"github.com/goccy/go-json"
+)
+
+var compileCache *util.DirCache
+
+func InitCompileCache() {
+	if config.CompileCacheSize <= 0 {
+		return
+	}
+	cache, err := util.NewDirCache(filepath.Join(config.CacheFilesPath, "compile"), config.CompileCacheSize)
+	if err != nil {
+		util.ErrorLog(err, "InitCompileCache()")
+		panic(err)
+	}
+	compileCache = cache
+	log.Println("[INFO] Init compile cache successfully")
+}
+
+type compileCacheKey struct {
+	Sources     []model.SourceCodeDescriptor
+	Archive     *model.ArchiveDescriptor
+	SyntaxCheck *model.Phase
+	Steps       []model.Phase
+	ExecName    string
+	Artifacts   []string
+	LogLimit    int64
+	Env         []string
+	User        string
+	Rootfs      string
+}
+
+func makeCompileCacheKey(phase model.CompilePhase) string {
+	sources := phase.SourceCodes
+	if phase.SourceCode.Name != "" {
+		sources = append([]model.SourceCodeDescriptor{phase.SourceCode}, sources...)
+	}
+	return util.HashKey(compileCacheKey{
+		Sources:     sources,
+		Archive:     phase.Archive,
+		SyntaxCheck: phase.SyntaxCheck,
+		Steps:       util.CompileSteps(phase),
+		ExecName:    phase.ExecName,
+		Artifacts:   phase.Artifacts,
+		LogLimit:    phase.LogLimit,
+		Env:         config.DefaultEnv,
+		User:        config.WorkUser,
+		Rootfs:      config.RootfsIdentity,
+	})
+}
+
+// loadCompileCache restores the artifacts into a new folder under parentPath
+// when the result is a success
+func loadCompileCache(key string, parentPath string) (string, *model.CompileResult, bool) {
+	if compileCache == nil {
+		return "", nil, false
+	}
+	dir, ok := compileCache.Get(key)
+	if !ok {
+		return "", nil, false
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "result.json"))
+	if err != nil {
+		util.ErrorLog(err, "loadCompileCache(): read result")
+		compileCache.Remove(key)
+		return "", nil, false
+	}
+	res := &model.CompileResult{}
+	if err = json.Unmarshal(b, res); err != nil {
+		util.ErrorLog(err, "loadCompileCache(): unmarshal result")
+		compileCache.Remove(key)
+		return "", nil, false
+	}
+	if !res.Succeed {
+		return "", res, true
+	}
+	runFolderName, runPath, err := util.Mkdir(parentPath)
+	if err != nil {
+		return "", nil, false
+	}
+	if err = util.CopyDir(filepath.Join(dir, "artifacts"), runPath); err != nil {
+		util.ErrorLog(err, "loadCompileCache(): copy artifacts")
+		os.RemoveAll(runPath)
+		return "", nil, false
+	}
+	return runFolderName, res, true
+}
+
+// Only results which would be the same next time are stored
+func storeCompileCache(key string, res *model.CompileResult, runPath string) {
+	if compileCache == nil || res.Reason != "" {
+		return
+	}
+	_, err := compileCache.Put(key, func(dir string) error {
+		b, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		if err = os.WriteFile(filepath.Join(dir, "result.json"), b, 0644); err != nil {
+			return err
+		}
+		if !res.Succeed {
+			return nil
+		}
+		return util.CopyDir(runPath, filepath.Join(dir, "artifacts"))
+	})
+	if err != nil {
+		util.ErrorLog(err, "storeCompileCache()")
+	}
+}
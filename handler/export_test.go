@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+	"github.com/opencontainers/runc/libcontainer/configs"
+)
+
+// Unexported helpers used by the tests of package handler_test
+
+var KattisResult = kattisResult
+
+var CheckerMounts = checkerMounts
+
+var ProgramMounts = programMounts
+
+func (p *Problem) CheckerConfig() CheckerConfig {
+	return p.checkerConfig()
+}
+
+func (c *CheckerConfig) RunArgs(program []string) []string {
+	return c.runArgs(program)
+}
+
+func (c *CheckerConfig) SetMounts(mounts []*configs.Mount) {
+	c.mounts = mounts
+}
+
+func SetMemoryCache(cache *util.DirCache) {
+	memoryCache = cache
+}
+
+func (p *Problem) HoldTestCases() ([]model.TestCase, func()) {
+	return p.holdTestCases()
+}
+
+func (p *Problem) TestCasesKey() (string, int64, error) {
+	return p.testCasesKey()
+}
@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+)
+
+// Generated test cases are kept by the built programs and the command
+var generatedCache *util.DirCache
+
+func initGeneratedCache() {
+	cache, err := util.NewDirCache(filepath.Join(config.CacheFilesPath, "generated"), 0)
+	if err != nil {
+		util.ErrorLog(err, "initGeneratedCache()")
+		panic(err)
+	}
+	generatedCache = cache
+}
+
+// GenerateConfig builds test cases in judge.yaml. Every command in Tests and
+// in the Script file is a generator name with its arguments, e.g. "gen 10 1".
+// The output of the generator is the input, the answer is the output of the
+// solution on it.
+type GenerateConfig struct {
+	Generators []GeneratorConfig `yaml:"generators"`
+	Solution   *SolutionConfig   `yaml:"solution"`
+	Script     string            `yaml:"script"`
+	Tests      []string          `yaml:"tests"`
+	commands   [][]string
+}
+
+type GeneratorConfig struct {
+	ProgramConfig `yaml:",inline"`
+	Name          string              `yaml:"name"`
+	Limits        config.LimitsConfig `yaml:"limits"`
+}
+
+type SolutionConfig struct {
+	ProgramConfig `yaml:",inline"`
+	Limits        config.LimitsConfig `yaml:"limits"`
+}
+
+// check reads the script, every command must name a generator
+func (g *GenerateConfig) check(problemPath string) error {
+	names := make(map[string]bool, 0)
+	for i := range g.Generators {
+		generator := &g.Generators[i]
+		if util.CheckFileName(generator.Name) != nil || strings.Contains(generator.Name, "/") || names[generator.Name] {
+			return fmt.Errorf("%w: invalid generator name %q", config.ErrProblemData, generator.Name)
+		}
+		names[generator.Name] = true
+		if err := generator.ProgramConfig.check(); err != nil {
+			return err
+		}
+		if generator.Limits.Time < 0 || generator.Limits.Memory < 0 {
+			return fmt.Errorf("%w: generator limits must not be negative", config.ErrProblemData)
+		}
+	}
+	if g.Solution == nil {
+		return fmt.Errorf("%w: generated tests need a solution", config.ErrProblemData)
+	}
+	if err := g.Solution.ProgramConfig.check(); err != nil {
+		return err
+	}
+	if g.Solution.Limits.Time < 0 || g.Solution.Limits.Memory < 0 {
+		return fmt.Errorf("%w: solution limits must not be negative", config.ErrProblemData)
+	}
+	lines := g.Tests
+	if g.Script != "" {
+		if util.CheckFileName(g.Script) != nil {
+			return fmt.Errorf("%w: invalid script %q", config.ErrProblemData, g.Script)
+		}
+		b, err := os.ReadFile(filepath.Join(problemPath, filepath.FromSlash(g.Script)))
+		if err != nil {
+			return fmt.Errorf("%w: cannot read %s", config.ErrProblemData, g.Script)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(b))
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+	}
+	g.commands = make([][]string, 0)
+	for _, line := range lines {
+		line, _, _ = strings.Cut(line, "#")
+		command := strings.Fields(line)
+		if len(command) == 0 {
+			continue
+		}
+		if !names[command[0]] {
+			return fmt.Errorf("%w: unknown generator in %q", config.ErrProblemData, line)
+		}
+		g.commands = append(g.commands, command)
+	}
+	return nil
+}
+
+type builtProgram struct {
+	dir   string
+	phase model.Phase
+}
+
+func buildGenerateProgram(program *ProgramConfig, problemPath string, args []string, limits config.LimitsConfig) (builtProgram, error) {
+	dir, run, err := program.build(problemPath)
+	if err != nil {
+		return builtProgram{}, err
+	}
+	return builtProgram{dir: dir, phase: toolPhase(run, args, limits)}, nil
+}
+
+// generateTests appends the generated test cases after those on disk
+func (p *Problem) generateTests() error {
+	g := p.Judge.Generate
+	if g == nil || len(g.commands) == 0 {
+		return nil
+	}
+	generators := make(map[string]*GeneratorConfig, 0)
+	for i := range g.Generators {
+		generators[g.Generators[i].Name] = &g.Generators[i]
+	}
+	solution, err := buildGenerateProgram(&g.Solution.ProgramConfig, p.Path, nil, g.Solution.Limits)
+	if err != nil {
+		return err
+	}
+	parentPath := ""
+	defer func() {
+		if parentPath != "" {
+			os.RemoveAll(filepath.Join(config.WorkDirGlobal, parentPath))
+		}
+	}()
+	workDirs := make(map[string]string, 0)
+	// workDir copies a built program into the work directory once
+	workDir := func(program builtProgram) (string, error) {
+		if dir, ok := workDirs[program.dir]; ok {
+			return dir, nil
+		}
+		if parentPath == "" {
+			folderName, _, err := util.Mkdir(config.WorkDirGlobal)
+			if err != nil {
+				return "", err
+			}
+			parentPath = folderName
+		}
+		folderName, path, err := util.Mkdir(filepath.Join(config.WorkDirGlobal, parentPath))
+		if err != nil {
+			return "", err
+		}
+		if err = util.CopyDir(program.dir, path); err != nil {
+			return "", errors.New("cannot copy program: " + err.Error())
+		}
+		workDirs[program.dir] = filepath.Join(parentPath, folderName)
+		return workDirs[program.dir], nil
+	}
+
+	built := make(map[string]builtProgram, 0)
+	for _, command := range g.commands {
+		generatorConfig := generators[command[0]]
+		generator, ok := built[command[0]]
+		if !ok {
+			generator, err = buildGenerateProgram(&generatorConfig.ProgramConfig, p.Path, nil, generatorConfig.Limits)
+			if err != nil {
+				return err
+			}
+			built[command[0]] = generator
+		}
+		generator.phase = toolPhase(generator.phase.RunArgs, command[1:], generatorConfig.Limits)
+		key := util.HashKey(struct {
+			Generator, Solution string
+			Phases              []model.Phase
+			Rootfs              string
+		}{filepath.Base(generator.dir), filepath.Base(solution.dir), []model.Phase{generator.phase, solution.phase}, config.RootfsIdentity})
+		dir, ok := generatedCache.Get(key)
+		if !ok {
+			dir, err = generatedCache.Put(key, func(dir string) error {
+				input := filepath.Join(dir, "input")
+				if err := runGenerateProgram(generator, workDir, "", input); err != nil {
+					return fmt.Errorf("%w: %s: %s", config.ErrProblemData, strings.Join(command, " "), err.Error())
+				}
+				if err := runGenerateProgram(solution, workDir, input, filepath.Join(dir, "answer")); err != nil {
+					return fmt.Errorf("%w: solution on %s: %s", config.ErrProblemData, strings.Join(command, " "), err.Error())
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		p.TestCases = append(p.TestCases, model.TestCase{
+			Input:  filepath.Join(dir, "input"),
+			Output: filepath.Join(dir, "answer"),
+		})
+	}
+	return nil
+}
+
+// runGenerateProgram writes stdout to outputPath, the program must exit with 0
+func runGenerateProgram(program builtProgram, workDir func(builtProgram) (string, error), inputPath string, outputPath string) error {
+	dir, err := workDir(program)
+	if err != nil {
+		return err
+	}
+	outFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer outFile.Close()
+	errFile, err := tempFile()
+	if err != nil {
+		return err
+	}
+	defer os.Remove(errFile.Name())
+	defer errFile.Close()
+	state, err := runTool(program.phase, dir, inputPath, outFile, errFile)
+	if err != nil {
+		return err
+	}
+	if state.Err == config.ErrTLE || state.Err == config.ErrOOM {
+		return state.Err
+	}
+	if state.ProcessState.ExitCode() != 0 {
+		msg := ""
+		if errMsg, err := util.LimitFileReader(errFile.Name(), config.OmitStringLen); err == nil && errMsg != nil {
+			msg = ": " + errMsg.S
+		}
+		return fmt.Errorf("exited with code %d%s", state.ProcessState.ExitCode(), msg)
+	}
+	return nil
+}
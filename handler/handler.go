@@ -2,73 +2,145 @@ package handler
 
 import (
 	"context"
+	stdjson "encoding/json"
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"syscall"
 
 	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/diag"
 	"github.com/HeRaNO/cdoj-execution-worker/model"
 	"github.com/HeRaNO/cdoj-execution-worker/util"
 	"github.com/goccy/go-json"
 	"github.com/opencontainers/runc/libcontainer"
+	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/rabbitmq/amqp091-go"
+	"golang.org/x/sys/unix"
 )
 
 func HandleReq(ctx context.Context, req amqp091.Delivery, ch *amqp091.Channel) {
+	Judge(req.Body, req.CorrelationId, func(resp amqp091.Publishing) {
+		ch.PublishWithContext(ctx, "", req.ReplyTo, false, false, resp)
+	})
+	req.Ack(false)
+}
+
+// Judge handles the body of a request, every response is given to reply
+func Judge(body []byte, corId string, reply func(amqp091.Publishing)) {
 	execReq := model.ExecRequest{}
-	err := json.Unmarshal(req.Body, &execReq)
+	err := json.Unmarshal(body, &execReq)
 
 	if err != nil {
 		util.ErrorLog(err, "Unmarshal")
-		ch.PublishWithContext(ctx, "", req.ReplyTo, false, false, util.InternalError(err, req.CorrelationId))
-		req.Ack(false)
+		// an empty field is the whole body. go-json names the Go field of a
+		// wrong type, encoding/json gives its path in the request.
+		fieldErr := model.FieldError{Field: "", Msg: "malformed JSON: " + err.Error()}
+		typeErr := &stdjson.UnmarshalTypeError{}
+		if errors.As(stdjson.Unmarshal(body, &model.ExecRequest{}), &typeErr) {
+			fieldErr.Field = typeErr.Field
+		}
+		reply(util.BadRequest([]model.FieldError{fieldErr}, corId))
+		return
+	}
+
+	if errs := util.ValidateRequest(&execReq); len(errs) != 0 {
+		reply(util.BadRequest(errs, corId))
+		return
+	}
+
+	problem, releaseProblem, err := holdProblem(execReq.RunPhases.ProblemID)
+	if err != nil {
+		reply(util.InternalError(err, corId))
 		return
 	}
+	defer releaseProblem()
 
-	testCases, ok := IDTestCasesMap[execReq.RunPhases.ProblemID]
-	if !ok {
-		err := errors.New("cannot find test cases for problemID: " + execReq.RunPhases.ProblemID)
-		ch.PublishWithContext(ctx, "", req.ReplyTo, false, false, util.InternalError(err, req.CorrelationId))
-		req.Ack(false)
+	if version := execReq.RunPhases.DataVersion; version != "" && version != problem.DataVersion {
+		reply(util.BadRequest([]model.FieldError{{
+			Field: "run_phases.data_version",
+			Msg:   fmt.Sprintf("the worker has data version %s", problem.DataVersion),
+		}}, corId))
 		return
 	}
 
+	// limits left out of the request are those declared by the problem package
+	limits := &execReq.RunPhases.Run.Limits
+	if limits.Time == 0 {
+		limits.Time = problem.Limits.Time
+	}
+	if limits.Memory == 0 {
+		limits.Memory = problem.Limits.Memory
+	}
+	if errs := util.ValidateRunLimits(*limits); len(errs) != 0 {
+		reply(util.BadRequest(errs, corId))
+		return
+	}
+
+	if problem.Interactor != nil {
+		err := errors.New("problemID: " + problem.ID + ": interactive problems are not supported")
+		reply(util.InternalError(err, corId))
+		return
+	}
+
+	release, err := problem.holdData()
+	if err != nil {
+		reply(util.InternalError(err, corId))
+		return
+	}
+	defer release()
+	testCases, releaseTestCases := problem.holdTestCases()
+	defer releaseTestCases()
+
 	runTestCaseDir, compileResult, parentPath, err := HandleCompilePhases(execReq.CompilePhases)
+	reqErr := &requestError{}
+	if errors.As(err, &reqErr) {
+		reply(util.BadRequest([]model.FieldError{{Field: reqErr.field, Msg: reqErr.err.Error()}}, corId))
+		if parentPath != "" {
+			os.RemoveAll(filepath.Join(config.WorkDirGlobal, parentPath))
+		}
+		return
+	}
 	if err != nil {
-		ch.PublishWithContext(ctx, "", req.ReplyTo, false, false, util.InternalError(err, req.CorrelationId))
-		req.Ack(false)
-		parentPath = filepath.Join(config.WorkDirGlobal, parentPath)
-		os.RemoveAll(parentPath)
+		reply(util.InternalError(err, corId))
+		if parentPath != "" {
+			parentPath = filepath.Join(config.WorkDirGlobal, parentPath)
+			os.RemoveAll(parentPath)
+		}
 		return
 	}
 	if !compileResult.Succeed {
-		ch.PublishWithContext(ctx, "", req.ReplyTo, false, false, util.CompileError(compileResult.ErrMsg, req.CorrelationId))
-		req.Ack(false)
+		reply(util.CompileError(compileResult, corId))
 		parentPath = filepath.Join(config.WorkDirGlobal, parentPath)
 		os.RemoveAll(parentPath)
 		return
 	}
 
-	checkPhase, runCheckDir, err := handleCheckerPrepare(execReq.CheckPhase, execReq.RunPhases.ProblemID, parentPath)
+	checkPhase, checker, runCheckDir, err := handleCheckerPrepare(execReq.CheckPhase, problem, parentPath)
 	if err != nil {
-		ch.PublishWithContext(ctx, "", req.ReplyTo, false, false, util.InternalError(err, req.CorrelationId))
-		req.Ack(false)
+		reply(util.InternalError(err, corId))
 		parentPath = filepath.Join(config.WorkDirGlobal, parentPath)
 		os.RemoveAll(parentPath)
 		return
 	}
 	runPhases := execReq.RunPhases
+	compileLog := util.MakeCompileLog(compileResult)
 
 	maxUserTime := int64(0)
 	maxMemory := int64(0)
 	failed := false
 
+	fileIO := runPhases.FileIO
+	if fileIO == nil {
+		fileIO = problem.Judge.FileIO
+	}
+
 	for i, testCase := range testCases {
-		ch.PublishWithContext(ctx, "", req.ReplyTo, false, false, util.RunningResp(i+1, req.CorrelationId))
-		result, outFile, err := HandleTestCaseRun(runPhases.Run, testCase.Input, runTestCaseDir)
+		reply(util.RunningResp(i+1, corId))
+		result, outFile, err := HandleTestCaseRun(runPhases.Run, testCase.Input, runTestCaseDir, fileIO)
 		if err != nil {
-			ch.PublishWithContext(ctx, "", req.ReplyTo, false, false, util.InternalError(err, req.CorrelationId))
+			reply(util.InternalError(err, corId))
 			failed = true
 			break
 		}
@@ -77,34 +149,55 @@ func HandleReq(ctx context.Context, req amqp091.Delivery, ch *amqp091.Channel) {
 			rusage := result.ProcessState.SysUsage().(*syscall.Rusage)
 			runRes := model.ExecResult{
 				Case:         int32(i + 1),
+				Group:        testCase.Group,
 				ExitCode:     result.ProcessState.ExitCode(),
 				UserTimeUsed: result.ProcessState.UserTime().Nanoseconds(),
 				SysTimeUsed:  result.ProcessState.SystemTime().Nanoseconds(),
 				MemoryUsed:   rusage.Maxrss,
+				CompileLog:   compileLog,
 			}
-			ch.PublishWithContext(ctx, "", req.ReplyTo, false, false, util.RunError(result.Err, runRes, req.CorrelationId))
+			reply(util.RunError(result.Err, runRes, corId))
 			failed = true
 			break
 		}
-		checkerResult, err := HandleCheckerRun(checkPhase, testCase, outFile, runCheckDir)
+		if outFile == "" {
+			rusage := result.ProcessState.SysUsage().(*syscall.Rusage)
+			runRes := model.ExecResult{
+				Case:         int32(i + 1),
+				Group:        testCase.Group,
+				ExitCode:     result.ProcessState.ExitCode(),
+				UserTimeUsed: result.ProcessState.UserTime().Nanoseconds(),
+				SysTimeUsed:  result.ProcessState.SystemTime().Nanoseconds(),
+				MemoryUsed:   rusage.Maxrss,
+				CompileLog:   compileLog,
+			}
+			reply(util.NoOutputResp(runRes, corId))
+			failed = true
+			break
+		}
+		checkerResult, err := HandleCheckerRun(checkPhase, checker, testCase, outFile, runCheckDir, logLimit(execReq.CheckLogLimit))
 		if err != nil {
 			os.Remove(outFile)
-			ch.PublishWithContext(ctx, "", req.ReplyTo, false, false, util.InternalError(err, req.CorrelationId))
+			reply(util.InternalError(err, corId))
 			failed = true
 			break
 		}
 		os.Remove(outFile)
-		if checkerResult.S[0] != 'o' {
+		if !checkerResult.Accepted {
 			rusage := result.ProcessState.SysUsage().(*syscall.Rusage)
 			runRes := model.ExecResult{
 				Case:          int32(i + 1),
+				Group:         testCase.Group,
 				ExitCode:      result.ProcessState.ExitCode(),
 				UserTimeUsed:  result.ProcessState.UserTime().Nanoseconds(),
 				SysTimeUsed:   result.ProcessState.SystemTime().Nanoseconds(),
 				MemoryUsed:    rusage.Maxrss,
-				CheckerResult: checkerResult,
+				CheckerResult: checkerResult.Message,
+				JudgeMessage:  checkerResult.JudgeMessage,
+				TeamMessage:   checkerResult.TeamMessage,
+				CompileLog:    compileLog,
 			}
-			ch.PublishWithContext(ctx, "", req.ReplyTo, false, false, util.WAResp(runRes, req.CorrelationId))
+			reply(util.WAResp(runRes, corId))
 			failed = true
 			break
 		}
@@ -119,17 +212,40 @@ func HandleReq(ctx context.Context, req amqp091.Delivery, ch *amqp091.Channel) {
 		runRes := model.ExecResult{
 			UserTimeUsed: maxUserTime,
 			MemoryUsed:   maxMemory,
+			CompileLog:   compileLog,
 		}
-		ch.PublishWithContext(ctx, "", req.ReplyTo, false, false, util.OKResp(runRes, req.CorrelationId))
+		reply(util.OKResp(runRes, corId))
 	}
 	parentPath = filepath.Join(config.WorkDirGlobal, parentPath)
 	os.RemoveAll(parentPath)
-	req.Ack(false)
 }
 
-func HandleTestCaseRun(phase model.Phase, inputPath string, workDir string) (*model.ProcessResult, string, error) {
-	workDir = filepath.Join(config.WorkDirInRootfs, workDir)
-	container, err := prepareContainer(phase, true)
+// HandleTestCaseRun runs the program in workDir on an input. With fileIO it
+// runs in a fresh directory that holds its files and the input named
+// fileIO.Input, and fileIO.Output is collected from there. The returned output
+// file is "" when the program did not write it.
+func HandleTestCaseRun(phase model.Phase, inputPath string, workDir string, fileIO *model.FileIO) (*model.ProcessResult, string, error) {
+	cwd := filepath.Join(config.WorkDirInRootfs, workDir)
+	mounts := make([]*configs.Mount, 0)
+	ioDir := ""
+	if fileIO != nil {
+		dirName, dirPath, err := util.Mkdir(filepath.Join(config.WorkDirGlobal, filepath.Dir(workDir)))
+		if err != nil {
+			return nil, "", errors.New("cannot create io directory: " + err.Error())
+		}
+		ioDir = dirPath
+		defer os.RemoveAll(ioDir)
+		if err = os.Chmod(ioDir, 0777); err != nil {
+			util.ErrorLog(err, "HandleTestCaseRun(): chmod io directory")
+			return nil, "", errors.New("cannot create io directory: " + err.Error())
+		}
+		cwd = filepath.Join(config.WorkDirInRootfs, filepath.Dir(workDir), dirName)
+		mounts, err = fileIOMounts(fileIO, inputPath, workDir, ioDir, cwd)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	container, err := prepareContainer(phase, true, mounts...)
 	if err != nil {
 		util.ErrorLog(err, "prepareContainer()")
 		return nil, "", errors.New("cannot init container: " + err.Error())
@@ -140,44 +256,104 @@ func HandleTestCaseRun(phase model.Phase, inputPath string, workDir string) (*mo
 		return nil, "", errors.New("cannot create tempfile: " + err.Error())
 	}
 	outFilePath := filepath.Join(config.CacheFilesPath, outFileName)
-	outFile, err := os.OpenFile(outFilePath, os.O_CREATE|os.O_RDWR, 0644)
-	if err != nil {
-		util.ErrorLog(err, "HandleTestCaseRun(): create temp file")
-		return nil, "", errors.New("cannot create temp file: " + err.Error())
-	}
-	inFile, err := os.Open(inputPath)
-	if err != nil {
-		util.ErrorLog(err, "HandleTestCaseRun(): open input file")
-		return nil, "", errors.New("cannot open input file: " + err.Error())
+	if fileIO != nil && fileIO.Output != "" {
+		// the output file is moved next to the io directory, which is on the same file system
+		outFilePath = filepath.Join(filepath.Dir(ioDir), outFileName)
 	}
 	noNewPriv := true
 	process := &libcontainer.Process{
 		Args:            phase.RunArgs,
 		Env:             config.DefaultEnv,
 		User:            config.WorkUser,
-		Cwd:             workDir,
-		Stdin:           inFile,
-		Stdout:          outFile,
+		Cwd:             cwd,
+		Stdin:           nil,
+		Stdout:          nil,
 		Stderr:          nil,
 		NoNewPrivileges: &noNewPriv,
 		Init:            true,
 	}
+	if fileIO == nil || fileIO.Output == "" {
+		outFile, err := os.OpenFile(outFilePath, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			util.ErrorLog(err, "HandleTestCaseRun(): create temp file")
+			return nil, "", errors.New("cannot create temp file: " + err.Error())
+		}
+		defer outFile.Close()
+		process.Stdout = outFile
+	}
+	if fileIO == nil || fileIO.Input == "" {
+		inFile, err := os.Open(inputPath)
+		if err != nil {
+			util.ErrorLog(err, "HandleTestCaseRun(): open input file")
+			return nil, "", errors.New("cannot open input file: " + err.Error())
+		}
+		defer inFile.Close()
+		process.Stdin = inFile
+	}
 	state, err := executeSingle(container, process, phase.Limits.Time)
 	if err != nil {
 		return nil, "", err
 	}
+	if fileIO != nil && fileIO.Output != "" {
+		stat, err := os.Lstat(filepath.Join(ioDir, fileIO.Output))
+		if err != nil || !stat.Mode().IsRegular() {
+			return state, "", nil
+		}
+		if err = os.Rename(filepath.Join(ioDir, fileIO.Output), outFilePath); err != nil {
+			util.ErrorLog(err, "HandleTestCaseRun(): collect output file")
+			return nil, "", errors.New("cannot collect output file: " + err.Error())
+		}
+	}
 	return state, outFilePath, nil
 }
 
-func HandleCheckerRun(phase model.Phase, testCase model.TestCase, userOutput string, workDir string) (*model.OmitString, error) {
-	workDirInRootfs := filepath.Join(config.WorkDirInRootfs, workDir)
-	workDirGlobal := filepath.Join(config.WorkDirGlobal, workDir)
-	container, err := prepareContainer(phase, false)
+// fileIOMounts makes ioDir, at cwd in the rootfs, the writable work directory
+// holding the files of the program and the input
+func fileIOMounts(fileIO *model.FileIO, inputPath string, workDir string, ioDir string, cwd string) ([]*configs.Mount, error) {
+	mounts := []*configs.Mount{{
+		Source:      ioDir,
+		Destination: cwd,
+		Device:      "bind",
+		Flags:       unix.MS_BIND | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC,
+	}}
+	programDir := filepath.Join(config.WorkDirGlobal, workDir)
+	ls, err := os.ReadDir(programDir)
 	if err != nil {
-		util.ErrorLog(err, "prepareContainer()")
-		return nil, errors.New("cannot init container: " + err.Error())
+		util.ErrorLog(err, "fileIOMounts(): read program directory")
+		return nil, err
 	}
-	defer container.Destroy()
+	for _, f := range ls {
+		if f.Name() == fileIO.Input || f.Name() == fileIO.Output {
+			return nil, errors.New("program file " + f.Name() + " has the name of an io file")
+		}
+		mounts = append(mounts, programBind(filepath.Join(programDir, f.Name()), filepath.Join(cwd, f.Name())))
+	}
+	if fileIO.Input != "" {
+		mounts = append(mounts, readOnlyBind(inputPath, filepath.Join(cwd, fileIO.Input)))
+	}
+	return mounts, nil
+}
+
+// checkerMounts mounts the checker, the test data and the user output, which
+// Kattis validators read from stdin, at stable paths in the work directory
+// instead of copying them
+func checkerMounts(checker CheckerConfig, testCase model.TestCase, userOutput string, workDirInRootfs string) []*configs.Mount {
+	files := checker.Files
+	mounts := append([]*configs.Mount{}, checker.mounts...)
+	mounts = append(mounts,
+		readOnlyBind(testCase.Input, filepath.Join(workDirInRootfs, files.Input)),
+		readOnlyBind(testCase.Output, filepath.Join(workDirInRootfs, files.Answer)),
+	)
+	if checker.Type != config.CheckerTypeKattis {
+		mounts = append(mounts, readOnlyBind(userOutput, filepath.Join(workDirInRootfs, files.Output)))
+	}
+	return mounts
+}
+
+func HandleCheckerRun(phase model.Phase, checker CheckerConfig, testCase model.TestCase, userOutput string, workDir string, limit int64) (*model.CheckerResult, error) {
+	files := checker.Files
+	workDirInRootfs := filepath.Join(config.WorkDirInRootfs, workDir)
+	workDirGlobal := filepath.Join(config.WorkDirGlobal, workDir)
 	errFileName, err := util.GenToken(20)
 	if err != nil {
 		return nil, errors.New("cannot create temp file: " + err.Error())
@@ -188,18 +364,34 @@ func HandleCheckerRun(phase model.Phase, testCase model.TestCase, userOutput str
 		util.ErrorLog(err, "HandleCheckerRun(): open error file")
 		return nil, errors.New("cannot create temp file: " + err.Error())
 	}
-	err = util.SafeCopy(testCase.Input, filepath.Join(workDirGlobal, "input"))
-	if err != nil {
-		return nil, errors.New("cannot copy input: " + err.Error())
-	}
-	err = util.SafeCopy(testCase.Output, filepath.Join(workDirGlobal, "answer"))
-	if err != nil {
-		return nil, errors.New("cannot copy answer: " + err.Error())
+	defer os.Remove(errFilePath)
+	defer errFile.Close()
+	mounts := checkerMounts(checker, testCase, userOutput, workDirInRootfs)
+	var stdin *os.File
+	feedbackPath := filepath.Join(workDirGlobal, files.Feedback)
+	if checker.Type == config.CheckerTypeKattis {
+		// Kattis output validators read the team output from stdin and write to the feedback directory
+		stdin, err = os.Open(userOutput)
+		if err != nil {
+			util.ErrorLog(err, "HandleCheckerRun(): open user output")
+			return nil, errors.New("cannot open user output: " + err.Error())
+		}
+		defer stdin.Close()
+		os.RemoveAll(feedbackPath)
+		if err = os.Mkdir(feedbackPath, 0777); err == nil {
+			err = os.Chmod(feedbackPath, 0777)
+		}
+		if err != nil {
+			util.ErrorLog(err, "HandleCheckerRun(): create feedback directory")
+			return nil, errors.New("cannot create feedback directory: " + err.Error())
+		}
 	}
-	err = util.SafeCopy(userOutput, filepath.Join(workDirGlobal, "user_out"))
+	container, err := prepareContainer(phase, false, mounts...)
 	if err != nil {
-		return nil, errors.New("cannot copy user_out: " + err.Error())
+		util.ErrorLog(err, "prepareContainer()")
+		return nil, errors.New("cannot init container: " + err.Error())
 	}
+	defer container.Destroy()
 	noNewPriv := true
 	process := &libcontainer.Process{
 		Args:            phase.RunArgs,
@@ -212,39 +404,87 @@ func HandleCheckerRun(phase model.Phase, testCase model.TestCase, userOutput str
 		NoNewPrivileges: &noNewPriv,
 		Init:            true,
 	}
+	if stdin != nil {
+		process.Stdin = stdin
+	}
 	state, err := executeSingle(container, process, phase.Limits.Time)
 	if err != nil {
 		return nil, err
 	}
-	if state.Err != nil && state.ProcessState.ExitCode() > 2 {
+	res := &model.CheckerResult{}
+	if checker.Type == config.CheckerTypeKattis {
+		res, err = kattisResult(state.ProcessState.ExitCode(), state.Err, workDirGlobal, files.Feedback, limit)
+		if err != nil {
+			util.ErrorLog(err, "HandleCheckerRun(): checker run error")
+			return nil, err
+		}
+	} else if state.Err != nil && state.ProcessState.ExitCode() > 2 {
 		util.ErrorLog(state.Err, "HandleCheckerRun(): checker run error")
 		return nil, state.Err
 	}
-	errMsg, err := util.LimitFileReader(errFilePath)
+	res.Message, err = util.LimitFileReader(errFilePath, limit)
 	if err != nil {
 		return nil, errors.New("cannot read errFile: " + err.Error())
 	}
-	os.Remove(errFilePath)
-	return errMsg, nil
+	if checker.Type != config.CheckerTypeKattis {
+		res.Accepted = res.Message != nil && res.Message.S[0] == 'o'
+	}
+	return res, nil
+}
+
+// kattisResult maps the exit code of a Kattis output validator, 42 accepts
+// and 43 rejects, and reads the feedback files in workDir/feedback
+func kattisResult(exitCode int, runErr error, workDir string, feedback string, limit int64) (*model.CheckerResult, error) {
+	res := &model.CheckerResult{}
+	switch exitCode {
+	case config.KattisExitAC:
+		res.Accepted = true
+	case config.KattisExitWA:
+	default:
+		if runErr == config.ErrTLE || runErr == config.ErrOOM {
+			return nil, errors.New("output validator: " + runErr.Error())
+		}
+		return nil, fmt.Errorf("output validator exited with code %d", exitCode)
+	}
+	res.JudgeMessage, _ = readOptionalFile(workDir, filepath.Join(feedback, "judgemessage.txt"), limit)
+	res.TeamMessage, _ = readOptionalFile(workDir, filepath.Join(feedback, "teammessage.txt"), limit)
+	return res, nil
+}
+
+// readOptionalFile reads a file the checker may have written under dir,
+// links are not followed since the checker controls the directory
+func readOptionalFile(dir string, name string, limit int64) (*model.OmitString, error) {
+	if hasSymlink(dir, name) {
+		return nil, nil
+	}
+	f, err := os.OpenFile(filepath.Join(dir, name), os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		return nil, err
+	}
+	return util.LimitReader(f, limit)
+}
+
+// logLimit is the length of a message returned for a request, limit is the
+// one the request sets
+func logLimit(limit int64) int64 {
+	if limit == 0 {
+		return config.OmitStringLen
+	}
+	return limit
 }
 
-func HandleCompilePhase(phase model.Phase, workDir string) (*model.CompileResult, error) {
+func HandleCompilePhase(phase model.Phase, workDir string, logFile *os.File) (*model.CompileResult, error) {
 	container, err := prepareContainer(phase, false)
 	if err != nil {
 		util.ErrorLog(err, "create container")
 		return nil, errors.New("cannot init container: " + err.Error())
 	}
 	defer container.Destroy()
-	errFileName, err := util.GenToken(20)
-	if err != nil {
-		return nil, errors.New("cannot create tempfile: " + err.Error())
-	}
-	errFilePath := filepath.Join(config.CacheFilesPath, errFileName)
-	errFile, err := os.OpenFile(errFilePath, os.O_CREATE|os.O_RDWR, 0644)
-	if err != nil {
-		util.ErrorLog(err, "handleCompilePhase(): create temp file")
-		return nil, errors.New("cannot create temp file: " + err.Error())
-	}
 	noNewPriv := true
 	process := &libcontainer.Process{
 		Args:            phase.RunArgs,
@@ -252,8 +492,8 @@ func HandleCompilePhase(phase model.Phase, workDir string) (*model.CompileResult
 		User:            config.WorkUser,
 		Cwd:             workDir,
 		Stdin:           nil,
-		Stdout:          nil,
-		Stderr:          errFile,
+		Stdout:          logFile,
+		Stderr:          logFile,
 		NoNewPrivileges: &noNewPriv,
 		Init:            true,
 	}
@@ -261,24 +501,82 @@ func HandleCompilePhase(phase model.Phase, workDir string) (*model.CompileResult
 	if err != nil {
 		return nil, err
 	}
-	errMsg, err := util.LimitFileReader(errFilePath)
+	res := &model.CompileResult{
+		Succeed: state.ProcessState.ExitCode() == 0 && state.Err == nil,
+	}
+	if state.ProcessState != nil {
+		res.Time = state.ProcessState.UserTime().Nanoseconds() + state.ProcessState.SystemTime().Nanoseconds()
+		res.Memory = state.ProcessState.SysUsage().(*syscall.Rusage).Maxrss
+	}
+	switch {
+	case state.Err == config.ErrTLE:
+		res.Reason = model.CompileReasonTLE
+	case state.Err == config.ErrOOM:
+		res.Reason = model.CompileReasonOOM
+	case state.ProcessState != nil && state.ProcessState.Sys().(syscall.WaitStatus).Signaled():
+		res.Reason = model.CompileReasonCrash
+	}
+	return res, nil
+}
+
+func runCompileSteps(phase model.CompilePhase, workDir string) (*model.CompileResult, error) {
+	logFileName, err := util.GenToken(20)
 	if err != nil {
-		return nil, errors.New("cannot read errFile: " + err.Error())
+		return nil, errors.New("cannot create tempfile: " + err.Error())
 	}
-	err = os.Remove(errFilePath)
+	logFilePath := filepath.Join(config.CacheFilesPath, logFileName)
+	logFile, err := os.OpenFile(logFilePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
 	if err != nil {
-		err := errors.New("cannot remove tempfile: " + err.Error())
-		util.ErrorLog(err, "handleCompilePhase(): remove file")
-		return nil, err
+		util.ErrorLog(err, "runCompileSteps(): create temp file")
+		return nil, errors.New("cannot create temp file: " + err.Error())
 	}
-	succeed := true
-	if state.ProcessState.ExitCode() != 0 {
-		succeed = false
+	defer os.Remove(logFilePath)
+	defer logFile.Close()
+
+	msg := &model.CompileResult{Succeed: true}
+	totalTime, maxMemory := int64(0), int64(0)
+	steps := util.CompileSteps(phase)
+	if phase.SyntaxCheck != nil {
+		steps = append([]model.Phase{*phase.SyntaxCheck}, steps...)
+	}
+	parsers := make([]string, 0)
+	for i, step := range steps {
+		msg, err = HandleCompilePhase(step, workDir, logFile)
+		if err != nil {
+			return nil, err
+		}
+		msg.Step = i
+		if phase.SyntaxCheck == nil {
+			msg.Step = i + 1
+		}
+		totalTime += msg.Time
+		if msg.Memory > maxMemory {
+			maxMemory = msg.Memory
+		}
+		msg.Time, msg.Memory = totalTime, maxMemory
+		if step.Diagnostics != "" {
+			parsers = append(parsers, step.Diagnostics)
+		}
+		if !msg.Succeed {
+			break
+		}
 	}
-	return &model.CompileResult{
-		Succeed: succeed,
-		ErrMsg:  errMsg,
-	}, nil
+	fullLog, err := util.LimitFileReader(logFilePath, config.MaxLogLimit)
+	if err != nil {
+		return nil, errors.New("cannot read compile log: " + err.Error())
+	}
+	if fullLog == nil {
+		return msg, nil
+	}
+	parsed := make(map[string]bool, 0)
+	for _, parser := range parsers {
+		if !parsed[parser] {
+			parsed[parser] = true
+			msg.Diagnostics = append(msg.Diagnostics, diag.Parse(parser, fullLog.S)...)
+		}
+	}
+	msg.ErrMsg = util.TruncateOmitString(fullLog, logLimit(phase.LogLimit))
+	return msg, nil
 }
 
 func HandleCompilePhases(phase model.CompilePhase) (string, *model.CompileResult, string, error) {
@@ -288,58 +586,126 @@ func HandleCompilePhases(phase model.CompilePhase) (string, *model.CompileResult
 	}
 	compileRootfsPath := filepath.Join(config.WorkDirInRootfs, folderName)
 
+	cacheKey := makeCompileCacheKey(phase)
+	if runFolderName, msg, ok := loadCompileCache(cacheKey, compileParentPath); ok {
+		if !msg.Succeed {
+			return "", msg, folderName, nil
+		}
+		return filepath.Join(folderName, runFolderName), msg, folderName, nil
+	}
+
 	compileFolderName, compilePath, err := util.Mkdir(compileParentPath)
 	if err != nil {
-		return "", nil, "", err
+		return "", nil, folderName, err
 	}
 	compilePathInRootfs := filepath.Join(compileRootfsPath, compileFolderName)
-	err = prepareCodeFile(phase.SourceCode, compilePath)
+	err = prepareCodeFiles(phase, compilePath)
 	if err != nil {
-		util.ErrorLog(err, "prepareCodeFile()")
-		return "", nil, "", err
+		util.ErrorLog(err, "prepareCodeFiles()")
+		return "", nil, folderName, err
 	}
-	msg, err := HandleCompilePhase(phase.Compile, compilePathInRootfs)
+	msg, err := runCompileSteps(phase, compilePathInRootfs)
 	if err != nil {
-		return "", msg, "", err
+		return "", msg, folderName, err
 	}
-	err = deleteCodeFile(phase.SourceCode, compilePath)
-	if err != nil {
-		util.ErrorLog(err, "deleteCodeFile()")
-		return "", msg, "", err
+	if !msg.Succeed {
+		storeCompileCache(cacheKey, msg, "")
+		return "", msg, folderName, nil
+	}
+	if phase.ExecName == "" && len(phase.Artifacts) == 0 {
+		storeCompileCache(cacheKey, msg, compilePath)
+		return filepath.Join(folderName, compileFolderName), msg, folderName, nil
 	}
 
-	return filepath.Join(folderName, compileFolderName), msg, folderName, nil
+	runFolderName, runPath, err := util.Mkdir(compileParentPath)
+	if err != nil {
+		return "", nil, folderName, err
+	}
+	missing, err := collectArtifacts(phase, len(util.CompileSteps(phase)) != 0, compilePath, runPath)
+	if err != nil {
+		return "", nil, folderName, err
+	}
+	if missing != "" {
+		errMsg := &model.OmitString{S: missing}
+		if msg.ErrMsg != nil {
+			errMsg.S += "\n" + msg.ErrMsg.S
+			errMsg.OmitSize = msg.ErrMsg.OmitSize
+		}
+		msg.Succeed = false
+		msg.ErrMsg = errMsg
+		storeCompileCache(cacheKey, msg, "")
+		return "", msg, folderName, nil
+	}
+	os.RemoveAll(compilePath)
+	storeCompileCache(cacheKey, msg, runPath)
+	return filepath.Join(folderName, runFolderName), msg, folderName, nil
 }
 
-func handleCheckerPrepare(checkMethod string, problemID string, parentPath string) (model.Phase, string, error) {
+func handleCheckerPrepare(checkMethod string, problem *Problem, parentPath string) (model.Phase, CheckerConfig, string, error) {
 	phase := model.Phase{}
+	checker := problem.checkerConfig()
+	if checkMethod == config.CheckMethodWcmp {
+		// fecmp is a testlib checker whatever judge.yaml says about the custom one
+		checker = DefaultCheckerConfig()
+	}
 	globalParentPath := filepath.Join(config.WorkDirGlobal, parentPath)
 	folderName, _, err := util.Mkdir(globalParentPath)
 	if err != nil {
-		return phase, "", err
+		return phase, checker, "", err
 	}
-	checkerPath := filepath.Join(globalParentPath, folderName)
 	checkerRelativePath := filepath.Join(parentPath, folderName)
-	oriChecker := ""
-	if checkMethod == "wcmp" {
-		oriChecker = filepath.Join(config.DataFilesPath, "fecmp")
-	} else {
-		if !IDCustomCheckerMap[problemID] {
-			return phase, "", errors.New("cannot find custom checker for problemID: " + problemID)
+	program := []string{"./checker"}
+	spj := filepath.Join(problem.Path, "spj")
+	var programDir string
+	switch {
+	case checkMethod == config.CheckMethodWcmp:
+		programDir, err = stageProgram(filepath.Join(config.DataFilesPath, "fecmp"), "checker")
+		if err != nil {
+			return phase, checker, "", errors.New("cannot prepare fecmp: " + err.Error())
+		}
+	case !problem.CustomChecker:
+		return phase, checker, "", errors.New("cannot find custom checker for problemID: " + problem.ID)
+	case !problem.hasCheckerProgram() && fileExists(spj):
+		programDir, err = stageProgram(spj, "checker")
+		if err != nil {
+			return phase, checker, "", errors.New("cannot prepare spj: " + err.Error())
+		}
+	default:
+		programDir, program, err = problem.checkerProgram().build(problem.Path)
+		if err != nil {
+			return phase, checker, "", err
 		}
-		oriChecker = filepath.Join(config.DataFilesPath, problemID, "spj")
 	}
-	err = util.SafeCopy(oriChecker, filepath.Join(checkerPath, "checker"))
+	// the checker is mounted from the cache, not copied for every submission
+	checker.mounts, err = programMounts(programDir, filepath.Join(config.WorkDirInRootfs, checkerRelativePath))
 	if err != nil {
-		return phase, "", errors.New("cannot copy fecmp: " + err.Error())
+		return phase, checker, "", errors.New("cannot read checker: " + err.Error())
 	}
 	phase = model.Phase{
-		Exec:    "checker",
-		RunArgs: []string{"./checker", "input", "user_out", "answer"},
+		Exec:    program[0],
+		RunArgs: checker.runArgs(program),
 		Limits: model.Limitation{
-			Time:   10000,
-			Memory: 1024 << 20,
+			Time:   checker.Limits.Time,
+			Memory: checker.Limits.Memory,
 		},
 	}
-	return phase, checkerRelativePath, nil
+	return phase, checker, checkerRelativePath, nil
+}
+
+// programMounts binds the files of programDir into destination in the rootfs
+func programMounts(programDir string, destination string) ([]*configs.Mount, error) {
+	ls, err := os.ReadDir(programDir)
+	if err != nil {
+		return nil, err
+	}
+	mounts := make([]*configs.Mount, 0, len(ls))
+	for _, f := range ls {
+		mounts = append(mounts, programBind(filepath.Join(programDir, f.Name()), filepath.Join(destination, f.Name())))
+	}
+	return mounts, nil
+}
+
+func fileExists(path string) bool {
+	stat, err := os.Stat(path)
+	return err == nil && stat.Mode().IsRegular()
 }
@@ -20,7 +20,7 @@ func TestHandleCompilePhases(t *testing.T) {
 		Content: "#include <cstdio>\n\nint main()\n{\n\tint a, b;\n\tscanf(\"%d %d\", &a, &b);\n\tprintf(\"%d\\n\", a + b);\n\treturn 0;\n}\n",
 	}
 	execReq := model.CompilePhase{
-		Compile: model.Phase{
+		Compile: &model.Phase{
 			Exec:    "g++",
 			RunArgs: []string{"g++", "main.cpp", "-o", "main", "-O2", "-std=c++17"},
 			Limits: model.Limitation{
@@ -55,7 +55,7 @@ func TestHandleTestCaseRun(t *testing.T) {
 		},
 		ProblemID: "1",
 	}
-	state, outFile, err := handler.HandleTestCaseRun(runPhase.Run, "/home/ubuntu/dataFiles/1/1.in", "FOiK9Oly6qZjYS5OpdxK/MEllxkYJ9Pe4u5aMJpoq")
+	state, outFile, err := handler.HandleTestCaseRun(runPhase.Run, "/home/ubuntu/dataFiles/1/1.in", "FOiK9Oly6qZjYS5OpdxK/MEllxkYJ9Pe4u5aMJpoq", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -80,7 +80,7 @@ func TestHandleCheckerRun(t *testing.T) {
 		Input:  "/home/ubuntu/dataFiles/1/1.in",
 		Output: "/home/ubuntu/dataFiles/1/1.out",
 	}
-	errMsg, err := handler.HandleCheckerRun(checkPhase, testCase, "/home/ubuntu/cacheFiles/vBFhk4RS4kcDzcWtAi44", "FOiK9Oly6qZjYS5OpdxK/p1PrOjvSp8HH8difqa0a")
+	errMsg, err := handler.HandleCheckerRun(checkPhase, handler.DefaultCheckerConfig(), testCase, "/home/ubuntu/cacheFiles/vBFhk4RS4kcDzcWtAi44", "FOiK9Oly6qZjYS5OpdxK/p1PrOjvSp8HH8difqa0a", config.OmitStringLen)
 	if err != nil {
 		t.Fatal(err)
 	}
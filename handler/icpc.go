@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"gopkg.in/yaml.v3"
+)
+
+const icpcProblemConfigName = "problem.yaml"
+
+// The parts of problem.yaml of the ICPC problem package format the worker uses
+type icpcProblemConfig struct {
+	Validation     string `yaml:"validation"`
+	ValidatorFlags string `yaml:"validator_flags"`
+	Limits         struct {
+		TimeLimit float64 `yaml:"time_limit"` // seconds
+		Memory    int64   `yaml:"memory"`     // MiB
+	} `yaml:"limits"`
+}
+
+func isICPCPackage(problemPath string) bool {
+	return fileExists(filepath.Join(problemPath, icpcProblemConfigName))
+}
+
+// loadICPCPackage reads data/sample and data/secret as test cases, the
+// output validator as a kattis checker and the input format validators as
+// kattis validators
+func (p *Problem) loadICPCPackage() error {
+	b, err := os.ReadFile(filepath.Join(p.Path, icpcProblemConfigName))
+	if err != nil {
+		return err
+	}
+	conf := icpcProblemConfig{}
+	if err = yaml.Unmarshal(b, &conf); err != nil {
+		return fmt.Errorf("%w: %s: %s", config.ErrProblemData, icpcProblemConfigName, err.Error())
+	}
+	if err = p.loadICPCLimits(conf); err != nil {
+		return err
+	}
+	dataPath := filepath.Join(p.Path, "data")
+	for _, group := range []string{"sample", "secret"} {
+		testCases, err := icpcTestCases(dataPath, group)
+		if err != nil {
+			return err
+		}
+		p.TestCases = append(p.TestCases, testCases...)
+	}
+	if len(p.TestCases) == 0 {
+		return fmt.Errorf("%w: problemID: %s: no test cases", config.ErrProblemData, p.ID)
+	}
+
+	validation := strings.Fields(conf.Validation)
+	if len(validation) == 0 {
+		validation = []string{"default"}
+	}
+	switch {
+	case validation[0] == "default" && conf.ValidatorFlags != "":
+		// fecmp has no float tolerance or case and space sensitivity to map them onto
+		return fmt.Errorf("%w: validator_flags %q of the default validator are not supported", config.ErrProblemData, conf.ValidatorFlags)
+	case validation[0] == "default":
+	case validation[0] != "custom":
+		return fmt.Errorf("%w: unknown validation %s", config.ErrProblemData, conf.Validation)
+	case len(validation) > 1:
+		return fmt.Errorf("%w: validation %s is not supported", config.ErrProblemData, conf.Validation)
+	default:
+		if err = p.loadICPCOutputValidator(conf.ValidatorFlags); err != nil {
+			return err
+		}
+	}
+
+	validators, err := packagePrograms(p.Path, "input_format_validators")
+	if err != nil {
+		return err
+	}
+	p.InputValidators = make([]ValidatorConfig, 0)
+	for _, program := range validators {
+		p.InputValidators = append(p.InputValidators, ValidatorConfig{
+			ProgramConfig: program,
+			Type:          config.CheckerTypeKattis,
+		})
+	}
+	return nil
+}
+
+func (p *Problem) loadICPCOutputValidator(flags string) error {
+	validators, err := packagePrograms(p.Path, "output_validators")
+	if err != nil {
+		return err
+	}
+	if len(validators) != 1 {
+		return fmt.Errorf("%w: want one output validator, found %d", config.ErrProblemData, len(validators))
+	}
+	args := append([]string{}, defaultCheckerArgs[config.CheckerTypeKattis]...)
+	checker := &CheckerConfig{
+		ProgramConfig: validators[0],
+		Type:          config.CheckerTypeKattis,
+		Args:          append(args, strings.Fields(flags)...),
+	}
+	if err = checker.check(); err != nil {
+		return err
+	}
+	p.Judge.Checker = checker
+	p.CustomChecker = true
+	return nil
+}
+
+// The time limit is limits.time_limit in problem.yaml, or .timelimit used by DOMjudge
+func (p *Problem) loadICPCLimits(conf icpcProblemConfig) error {
+	timeLimit := conf.Limits.TimeLimit
+	if b, err := os.ReadFile(filepath.Join(p.Path, ".timelimit")); err == nil && timeLimit == 0 {
+		timeLimit, err = strconv.ParseFloat(strings.TrimSpace(string(b)), 64)
+		if err != nil {
+			return fmt.Errorf("%w: .timelimit: %s", config.ErrProblemData, err.Error())
+		}
+	}
+	if timeLimit < 0 || conf.Limits.Memory < 0 {
+		return fmt.Errorf("%w: limits must not be negative", config.ErrProblemData)
+	}
+	p.Limits.Time = int32(math.Ceil(timeLimit * 1000))
+	p.Limits.Memory = conf.Limits.Memory << 20
+	return nil
+}
+
+// icpcTestCases walks a group in lexicographical order, every N.in needs an N.ans
+func icpcTestCases(dataPath string, group string) ([]model.TestCase, error) {
+	testCases := make([]model.TestCase, 0)
+	root := filepath.Join(dataPath, group)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return testCases, nil
+	}
+	err := filepath.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(filePath) != ".in" || !fileExists(filePath) {
+			return nil
+		}
+		answer := strings.TrimSuffix(filePath, ".in") + ".ans"
+		if !fileExists(answer) {
+			return fmt.Errorf("%w: no answer file for %s", config.ErrProblemData, filePath)
+		}
+		rel, err := filepath.Rel(dataPath, filepath.Dir(filePath))
+		if err != nil {
+			return err
+		}
+		testCases = append(testCases, model.TestCase{
+			Input:  filePath,
+			Output: answer,
+			Group:  filepath.ToSlash(rel),
+			Sample: group == "sample",
+		})
+		return nil
+	})
+	return testCases, err
+}
+
+// packagePrograms finds the programs in a folder of a problem package. Each
+// one is a source file, or a folder with one source file and its headers.
+// Languages are chosen by extension, other files are ignored.
+func packagePrograms(problemPath string, dir string) ([]ProgramConfig, error) {
+	programs := make([]ProgramConfig, 0)
+	ls, err := os.ReadDir(filepath.Join(problemPath, dir))
+	if os.IsNotExist(err) {
+		return programs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range ls {
+		name := path.Join(dir, f.Name())
+		if !f.IsDir() {
+			if language, ok := config.LanguageByExtension(path.Ext(name)); ok {
+				programs = append(programs, ProgramConfig{Source: name, Language: language})
+			}
+			continue
+		}
+		program, err := packageProgramDir(problemPath, name)
+		if err != nil {
+			return nil, err
+		}
+		programs = append(programs, program)
+	}
+	for i := range programs {
+		if err = programs[i].check(); err != nil {
+			return nil, err
+		}
+	}
+	return programs, nil
+}
+
+func packageProgramDir(problemPath string, dir string) (ProgramConfig, error) {
+	program := ProgramConfig{}
+	ls, err := os.ReadDir(filepath.Join(problemPath, filepath.FromSlash(dir)))
+	if err != nil {
+		return program, err
+	}
+	for _, f := range ls {
+		if !f.Type().IsRegular() {
+			continue
+		}
+		name := path.Join(dir, f.Name())
+		language, ok := config.LanguageByExtension(path.Ext(name))
+		if !ok {
+			program.Include = append(program.Include, name)
+			continue
+		}
+		if program.Source != "" {
+			return program, fmt.Errorf("%w: more than one source in %s", config.ErrProblemData, dir)
+		}
+		program.Source = name
+		program.Language = language
+	}
+	if program.Source == "" {
+		return program, fmt.Errorf("%w: no source in %s", config.ErrProblemData, dir)
+	}
+	return program, nil
+}
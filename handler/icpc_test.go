@@ -0,0 +1,93 @@
+package handler_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/handler"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		filePath := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadICPCPackage(t *testing.T) {
+	config.DataFilesPath = t.TempDir()
+	config.Languages = map[string]config.LanguageConfig{
+		"cpp": {Source: "main.cpp", Exec: "main", Run: []string{"./main"}, Extensions: []string{".cpp"}},
+	}
+	writeFiles(t, filepath.Join(config.DataFilesPath, "hello"), map[string]string{
+		"problem.yaml":                                "validation: custom\nvalidator_flags: float_tolerance 1e-6\nlimits:\n  memory: 256\n",
+		".timelimit":                                  "1.5\n",
+		"data/sample/1.in":                            "1\n",
+		"data/sample/1.ans":                           "1\n",
+		"data/secret/b/1.in":                          "3\n",
+		"data/secret/b/1.ans":                         "3\n",
+		"data/secret/a.in":                            "2\n",
+		"data/secret/a.ans":                           "2\n",
+		"output_validators/check/check.cpp":           "",
+		"output_validators/check/validate.h":          "",
+		"input_format_validators/validate.cpp":        "",
+		"input_format_validators/README":              "",
+		"input_format_validators/other/validator.cpp": "",
+	})
+
+	p, err := handler.ReadProblem("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	groups := []string{"sample", "secret", "secret/b"}
+	if len(p.TestCases) != len(groups) {
+		t.Fatalf("got %d test cases, want %d", len(p.TestCases), len(groups))
+	}
+	for i, testCase := range p.TestCases {
+		if testCase.Group != groups[i] || testCase.Sample != (i == 0) {
+			t.Errorf("test case %d: group %q sample %v", i, testCase.Group, testCase.Sample)
+		}
+	}
+	if p.Limits.Time != 1500 || p.Limits.Memory != 256<<20 {
+		t.Errorf("got limits %+v", p.Limits)
+	}
+	checker := p.Judge.Checker
+	if !p.CustomChecker || checker == nil || checker.Type != config.CheckerTypeKattis {
+		t.Fatalf("output validator should be a kattis checker: %+v", checker)
+	}
+	if checker.Source != "output_validators/check/check.cpp" || len(checker.Include) != 1 {
+		t.Errorf("got checker program %+v", checker.ProgramConfig)
+	}
+	if len(checker.Args) != 5 || checker.Args[3] != "float_tolerance" {
+		t.Errorf("validator flags should follow the default args: %v", checker.Args)
+	}
+	if len(p.InputValidators) != 2 {
+		t.Errorf("got input validators %+v", p.InputValidators)
+	}
+
+	writeFiles(t, filepath.Join(config.DataFilesPath, "broken"), map[string]string{
+		"problem.yaml":     "",
+		"data/secret/1.in": "1\n",
+	})
+	if _, err := handler.ReadProblem("broken"); err == nil {
+		t.Error("input without answer should be rejected")
+	}
+
+	writeFiles(t, filepath.Join(config.DataFilesPath, "float"), map[string]string{
+		"problem.yaml":      "validator_flags: float_tolerance 1e-6\n",
+		"data/secret/1.in":  "1\n",
+		"data/secret/1.ans": "1.0\n",
+	})
+	if _, err := handler.ReadProblem("float"); !errors.Is(err, config.ErrProblemData) {
+		t.Errorf("flags of the default validator should be rejected: %v", err)
+	}
+}
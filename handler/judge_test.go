@@ -0,0 +1,42 @@
+package handler_test
+
+import (
+	"testing"
+
+	"github.com/HeRaNO/cdoj-execution-worker/handler"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/goccy/go-json"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+func judgeOnce(t *testing.T, body string) (model.Response, []model.FieldError) {
+	resps := make([]model.Response, 0)
+	handler.Judge([]byte(body), "1", func(p amqp091.Publishing) {
+		resp := model.Response{}
+		if err := json.Unmarshal(p.Body, &resp); err != nil {
+			t.Fatal(err)
+		}
+		resps = append(resps, resp)
+	})
+	if len(resps) != 1 {
+		t.Fatalf("expected one response, got %+v", resps)
+	}
+	errs := make([]model.FieldError, 0)
+	if resps[0].ErrCode == model.BR {
+		if err := json.Unmarshal([]byte(resps[0].Data), &errs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resps[0], errs
+}
+
+func TestJudgeMalformedRequest(t *testing.T) {
+	resp, errs := judgeOnce(t, `{"compile_phases": `)
+	if resp.ErrCode != model.BR || len(errs) != 1 {
+		t.Errorf("malformed JSON should be a bad request: %+v", resp)
+	}
+	resp, errs = judgeOnce(t, `{"run_phases": {"pid": 1}}`)
+	if resp.ErrCode != model.BR || len(errs) != 1 || errs[0].Field != "run_phases.pid" {
+		t.Errorf("wrong type should be a bad request on its field: %+v", resp)
+	}
+}
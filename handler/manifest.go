@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+)
+
+const manifestName = "manifest.json"
+
+// Verified data versions are kept by the sizes and modification times of the files
+var manifestCache *util.DirCache
+
+func initManifestCache() {
+	cache, err := util.NewDirCache(filepath.Join(config.CacheFilesPath, "manifest"), 0)
+	if err != nil {
+		util.ErrorLog(err, "initManifestCache()")
+		panic(err)
+	}
+	manifestCache = cache
+}
+
+// testCaseFiles are the files of the test cases in the problem folder, slash
+// separated. A data archive stands for the test cases extracted from it.
+func (p *Problem) testCaseFiles() []string {
+	seen := make(map[string]bool, 0)
+	files := make([]string, 0)
+	paths := make([]string, 0)
+	if p.Archive != "" {
+		paths = append(paths, p.Archive)
+	}
+	for _, testCase := range p.TestCases {
+		paths = append(paths, testCase.Input, testCase.Output)
+	}
+	for _, filePath := range paths {
+		rel, err := filepath.Rel(p.Path, filePath)
+		if err != nil || strings.HasPrefix(rel, "..") || seen[rel] {
+			continue
+		}
+		seen[rel] = true
+		files = append(files, filepath.ToSlash(rel))
+	}
+	sort.Strings(files)
+	return files
+}
+
+// verifyData checks the files in manifest.json, which must list every test
+// case, and sets DataVersion. Without a manifest the version is that of the
+// test case files.
+func (p *Problem) verifyData() error {
+	manifestPath := filepath.Join(p.Path, manifestName)
+	var manifest *util.Manifest
+	files := p.testCaseFiles()
+	manifestHash := ""
+	if fileExists(manifestPath) {
+		var err error
+		manifest, err = util.ReadManifest(manifestPath)
+		if err != nil {
+			return err
+		}
+		for _, name := range files {
+			if !manifest.Contains(name) {
+				return fmt.Errorf("%w: problemID: %s: %s is not in %s", config.ErrProblemData, p.ID, name, manifestName)
+			}
+		}
+		files = files[:0]
+		for _, entry := range manifest.Files {
+			files = append(files, entry.Path)
+		}
+		if manifestHash, err = util.FileSHA256(manifestPath); err != nil {
+			return err
+		}
+	}
+
+	key, ok := p.dataStatKey(manifestHash, files)
+	if ok {
+		if dir, ok := manifestCache.Get(key); ok {
+			if b, err := os.ReadFile(filepath.Join(dir, "version")); err == nil {
+				p.DataVersion = string(b)
+				return nil
+			}
+			manifestCache.Remove(key)
+		}
+	}
+	if manifest != nil {
+		if err := manifest.Verify(p.Path); err != nil {
+			return fmt.Errorf("problemID: %s: %w", p.ID, err)
+		}
+	} else {
+		var err error
+		if manifest, err = util.MakeManifest(p.Path, files); err != nil {
+			return err
+		}
+	}
+	p.DataVersion = manifest.Version()
+	if ok {
+		_, err := manifestCache.Put(key, func(dir string) error {
+			return os.WriteFile(filepath.Join(dir, "version"), []byte(p.DataVersion), 0644)
+		})
+		if err != nil {
+			util.ErrorLog(err, "verifyData(): store version")
+		}
+	}
+	return nil
+}
+
+// dataStatKey is false when a file cannot be read, verifying it then tells why
+func (p *Problem) dataStatKey(manifestHash string, files []string) (string, bool) {
+	type fileStat struct {
+		Path    string
+		Size    int64
+		ModTime int64
+	}
+	stats := make([]fileStat, 0, len(files))
+	for _, name := range files {
+		stat, err := os.Stat(filepath.Join(p.Path, filepath.FromSlash(name)))
+		if err != nil {
+			return "", false
+		}
+		stats = append(stats, fileStat{name, stat.Size(), stat.ModTime().UnixNano()})
+	}
+	return util.HashKey(struct {
+		Path     string
+		Manifest string
+		Files    []fileStat
+	}{p.Path, manifestHash, stats}), true
+}
+
+// problemFiles are the regular files of the problem folder, slash separated,
+// except manifest.json and hidden files. A remote source fetches nothing else.
+func (p *Problem) problemFiles() ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(p.Path, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath == p.Path {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !fileExists(filePath) {
+			return nil
+		}
+		rel, err := filepath.Rel(p.Path, filePath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == manifestName {
+			return nil
+		}
+		if err = util.CheckFileName(rel); err != nil {
+			return fmt.Errorf("%w: %s: %s", config.ErrProblemData, rel, err.Error())
+		}
+		files = append(files, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// WriteManifest writes manifest.json with every file of a problem folder
+func WriteManifest(problemID string) (string, error) {
+	problem, err := ReadProblem(problemID)
+	if err != nil {
+		return "", err
+	}
+	files, err := problem.problemFiles()
+	if err != nil {
+		return "", err
+	}
+	manifest, err := util.MakeManifest(problem.Path, files)
+	if err != nil {
+		return "", err
+	}
+	if err = manifest.Write(filepath.Join(problem.Path, manifestName)); err != nil {
+		return "", err
+	}
+	return manifest.Version(), nil
+}
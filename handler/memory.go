@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+	"golang.org/x/sys/unix"
+)
+
+// The test data of recently judged problems is copied into a tmpfs, nil when
+// it is disabled
+var memoryCache *util.DirCache
+
+func initMemoryCache() {
+	if config.MemoryCacheSize <= 0 {
+		return
+	}
+	err := os.MkdirAll(config.MemoryCachePath, 0755)
+	if err == nil {
+		stat := unix.Statfs_t{}
+		err = unix.Statfs(config.MemoryCachePath, &stat)
+		if err == nil && stat.Type != unix.TMPFS_MAGIC && stat.Type != unix.RAMFS_MAGIC {
+			err = errors.New(config.MemoryCachePath + " is not a tmpfs")
+		}
+	}
+	if err != nil {
+		util.ErrorLog(err, "initMemoryCache()")
+		panic(err)
+	}
+	cache, err := util.NewDirCache(config.MemoryCachePath, config.MemoryCacheSize)
+	if err != nil {
+		util.ErrorLog(err, "initMemoryCache()")
+		panic(err)
+	}
+	memoryCache = cache
+}
+
+// holdTestCases returns the test cases in memoryCache and keeps them until
+// release is called. The test cases on disk are returned when the memory
+// cache is disabled or too small for the problem.
+func (p *Problem) holdTestCases() ([]model.TestCase, func()) {
+	if memoryCache == nil {
+		return p.TestCases, func() {}
+	}
+	key, size, err := p.testCasesKey()
+	if err != nil {
+		util.ErrorLog(err, "holdTestCases(): stat problem "+p.ID)
+		return p.TestCases, func() {}
+	}
+	if size > config.MemoryCacheSize {
+		return p.TestCases, func() {}
+	}
+	dir, release, err := memoryCache.HoldOrPut(key, func(dir string) error {
+		for i, testCase := range p.TestCases {
+			input, output := memoryTestCase(dir, i)
+			if err := util.SafeCopy(testCase.Input, input); err != nil {
+				return err
+			}
+			if err := util.SafeCopy(testCase.Output, output); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		util.ErrorLog(err, "holdTestCases(): copy problem "+p.ID)
+		return p.TestCases, func() {}
+	}
+	testCases := make([]model.TestCase, len(p.TestCases))
+	for i, testCase := range p.TestCases {
+		testCases[i] = testCase
+		testCases[i].Input, testCases[i].Output = memoryTestCase(dir, i)
+	}
+	return testCases, release
+}
+
+// testCasesKey is the hash of the paths, sizes and modification times of the
+// test case files, generated ones included, with their total size
+func (p *Problem) testCasesKey() (string, int64, error) {
+	type fileStat struct {
+		Path    string
+		Size    int64
+		ModTime int64
+	}
+	stats := make([]fileStat, 0, 2*len(p.TestCases))
+	size := int64(0)
+	for _, testCase := range p.TestCases {
+		for _, filePath := range []string{testCase.Input, testCase.Output} {
+			stat, err := os.Stat(filePath)
+			if err != nil {
+				return "", 0, err
+			}
+			stats = append(stats, fileStat{filePath, stat.Size(), stat.ModTime().UnixNano()})
+			size += stat.Size()
+		}
+	}
+	return util.HashKey(stats), size, nil
+}
+
+func memoryTestCase(dir string, i int) (string, string) {
+	return filepath.Join(dir, fmt.Sprintf("%d.in", i+1)), filepath.Join(dir, fmt.Sprintf("%d.ans", i+1))
+}
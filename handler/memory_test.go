@@ -0,0 +1,86 @@
+package handler_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/handler"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+)
+
+func memoryProblem(t *testing.T) *handler.Problem {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"1.in": "1 2\n", "1.out": "3\n"})
+	return &handler.Problem{ID: "1", TestCases: []model.TestCase{{
+		Input:  filepath.Join(dir, "1.in"),
+		Output: filepath.Join(dir, "1.out"),
+	}}}
+}
+
+func TestHoldTestCases(t *testing.T) {
+	p := memoryProblem(t)
+	handler.SetMemoryCache(nil)
+	testCases, release := p.HoldTestCases()
+	release()
+	if testCases[0].Input != p.TestCases[0].Input {
+		t.Errorf("disabled cache should return the files on disk: %+v", testCases)
+	}
+
+	root := t.TempDir()
+	cache, err := util.NewDirCache(root, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler.SetMemoryCache(cache)
+	defer handler.SetMemoryCache(nil)
+	size := config.MemoryCacheSize
+	defer func() { config.MemoryCacheSize = size }()
+
+	config.MemoryCacheSize = 4
+	testCases, release = p.HoldTestCases()
+	release()
+	if testCases[0].Input != p.TestCases[0].Input {
+		t.Errorf("problem over the budget should be read from disk: %+v", testCases)
+	}
+
+	config.MemoryCacheSize = 1 << 20
+	testCases, release = p.HoldTestCases()
+	defer release()
+	if !strings.HasPrefix(testCases[0].Input, root) || !strings.HasPrefix(testCases[0].Output, root) {
+		t.Fatalf("test cases should be copied into the cache: %+v", testCases)
+	}
+	b, err := os.ReadFile(testCases[0].Output)
+	if err != nil || string(b) != "3\n" {
+		t.Errorf("cached answer is %q, %v", b, err)
+	}
+	if p.TestCases[0].Input == testCases[0].Input {
+		t.Error("the test cases of the problem should not be changed")
+	}
+}
+
+func TestTestCasesKey(t *testing.T) {
+	p := memoryProblem(t)
+	key, size, err := p.TestCasesKey()
+	if err != nil || size != 6 {
+		t.Fatalf("key %q of size %d, %v", key, size, err)
+	}
+	if again, _, _ := p.TestCasesKey(); again != key {
+		t.Error("key should be stable")
+	}
+	later := time.Now().Add(time.Hour)
+	if err = os.Chtimes(p.TestCases[0].Output, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if changed, _, _ := p.TestCasesKey(); changed == key {
+		t.Error("key should change with the modification time of a file")
+	}
+	os.Remove(p.TestCases[0].Input)
+	if _, _, err = p.TestCasesKey(); err == nil {
+		t.Error("missing test case should be an error")
+	}
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+)
+
+const polygonProblemConfigName = "problem.xml"
+
+// The parts of problem.xml of a Polygon package the worker uses
+type polygonProblem struct {
+	Judging    polygonJudging   `xml:"judging"`
+	Resources  []polygonFile    `xml:"files>resources>file"`
+	Checker    *polygonProgram  `xml:"assets>checker"`
+	Interactor *polygonProgram  `xml:"assets>interactor"`
+	Validators []polygonProgram `xml:"assets>validators>validator"`
+}
+
+// Empty file names are stdin and stdout
+type polygonJudging struct {
+	InputFile  string           `xml:"input-file,attr"`
+	OutputFile string           `xml:"output-file,attr"`
+	Testsets   []polygonTestset `xml:"testset"`
+}
+
+type polygonTestset struct {
+	Name              string         `xml:"name,attr"`
+	TimeLimit         int32          `xml:"time-limit"`   // ms
+	MemoryLimit       int64          `xml:"memory-limit"` // bytes
+	TestCount         int            `xml:"test-count"`
+	InputPathPattern  string         `xml:"input-path-pattern"`
+	AnswerPathPattern string         `xml:"answer-path-pattern"`
+	Tests             []polygonTest  `xml:"tests>test"`
+	Groups            []polygonGroup `xml:"groups>group"`
+}
+
+type polygonTest struct {
+	Sample bool    `xml:"sample,attr"`
+	Points float64 `xml:"points,attr"`
+	Group  string  `xml:"group,attr"`
+}
+
+type polygonGroup struct {
+	Name         string  `xml:"name,attr"`
+	Points       float64 `xml:"points,attr"`
+	PointsPolicy string  `xml:"points-policy,attr"`
+	Dependencies []struct {
+		Group string `xml:"group,attr"`
+	} `xml:"dependencies>dependency"`
+}
+
+type polygonProgram struct {
+	Type   string      `xml:"type,attr"`
+	Source polygonFile `xml:"source"`
+}
+
+type polygonFile struct {
+	Path string `xml:"path,attr"`
+	Type string `xml:"type,attr"`
+}
+
+func isPolygonPackage(problemPath string) bool {
+	return fileExists(filepath.Join(problemPath, polygonProblemConfigName))
+}
+
+// loadPolygonPackage reads the testset named tests, or the first one, and the
+// checker, interactor and validators. Test files are used where they are.
+func (p *Problem) loadPolygonPackage() error {
+	b, err := os.ReadFile(filepath.Join(p.Path, polygonProblemConfigName))
+	if err != nil {
+		return err
+	}
+	conf := polygonProblem{}
+	if err = xml.Unmarshal(b, &conf); err != nil {
+		return fmt.Errorf("%w: %s: %s", config.ErrProblemData, polygonProblemConfigName, err.Error())
+	}
+	if len(conf.Judging.Testsets) == 0 {
+		return fmt.Errorf("%w: problemID: %s: no testset", config.ErrProblemData, p.ID)
+	}
+	testset := conf.Judging.Testsets[0]
+	for _, t := range conf.Judging.Testsets {
+		if t.Name == "tests" {
+			testset = t
+		}
+	}
+	if testset.TimeLimit < 0 || testset.MemoryLimit < 0 {
+		return fmt.Errorf("%w: limits must not be negative", config.ErrProblemData)
+	}
+	p.Limits = config.LimitsConfig{Time: testset.TimeLimit, Memory: testset.MemoryLimit}
+	if conf.Judging.InputFile != "" || conf.Judging.OutputFile != "" {
+		fileIO := model.FileIO{Input: conf.Judging.InputFile, Output: conf.Judging.OutputFile}
+		if err = util.CheckFileIO(fileIO); err != nil {
+			return fmt.Errorf("%w: %s: %s", config.ErrProblemData, polygonProblemConfigName, err.Error())
+		}
+		p.Judge.FileIO = &fileIO
+	}
+	if err = p.loadPolygonTests(testset); err != nil {
+		return err
+	}
+
+	include := make([]string, 0)
+	for _, resource := range conf.Resources {
+		if strings.HasPrefix(resource.Type, "h.") {
+			include = append(include, resource.Path)
+		}
+	}
+	if conf.Checker != nil {
+		if conf.Checker.Type != "" && conf.Checker.Type != config.CheckerTypeTestlib {
+			return fmt.Errorf("%w: checker type %s is not supported", config.ErrProblemData, conf.Checker.Type)
+		}
+		program, err := conf.Checker.program(include)
+		if err != nil {
+			return err
+		}
+		p.Judge.Checker = &CheckerConfig{ProgramConfig: program, Type: config.CheckerTypeTestlib}
+		p.CustomChecker = true
+	}
+	if conf.Interactor != nil {
+		program, err := conf.Interactor.program(include)
+		if err != nil {
+			return err
+		}
+		p.Interactor = &program
+	}
+	for _, validator := range conf.Validators {
+		program, err := validator.program(include)
+		if err != nil {
+			return err
+		}
+		p.InputValidators = append(p.InputValidators, ValidatorConfig{
+			ProgramConfig: program,
+			Type:          config.CheckerTypeTestlib,
+		})
+	}
+	return nil
+}
+
+func (p *Problem) loadPolygonTests(testset polygonTestset) error {
+	if testset.TestCount != len(testset.Tests) {
+		return fmt.Errorf("%w: test-count is %d, found %d tests", config.ErrProblemData, testset.TestCount, len(testset.Tests))
+	}
+	if len(testset.Tests) == 0 {
+		return fmt.Errorf("%w: problemID: %s: no test cases", config.ErrProblemData, p.ID)
+	}
+	for i, test := range testset.Tests {
+		input, err := polygonTestPath(testset.InputPathPattern, i+1)
+		if err != nil {
+			return err
+		}
+		answer, err := polygonTestPath(testset.AnswerPathPattern, i+1)
+		if err != nil {
+			return err
+		}
+		testCase := model.TestCase{
+			Input:  filepath.Join(p.Path, filepath.FromSlash(input)),
+			Output: filepath.Join(p.Path, filepath.FromSlash(answer)),
+			Group:  test.Group,
+			Sample: test.Sample,
+			Points: test.Points,
+		}
+		if !fileExists(testCase.Input) || !fileExists(testCase.Output) {
+			return fmt.Errorf("%w: missing %s or %s, generated tests must be in the package", config.ErrProblemData, input, answer)
+		}
+		p.TestCases = append(p.TestCases, testCase)
+	}
+	for _, group := range testset.Groups {
+		testGroup := TestGroup{
+			Name:   group.Name,
+			Points: group.Points,
+			Policy: group.PointsPolicy,
+		}
+		for _, dependency := range group.Dependencies {
+			testGroup.Dependencies = append(testGroup.Dependencies, dependency.Group)
+		}
+		p.Groups = append(p.Groups, testGroup)
+	}
+	return nil
+}
+
+// polygonTestPath fills the 1-based test index into a pattern like tests/%02d
+func polygonTestPath(pattern string, index int) (string, error) {
+	if strings.Count(pattern, "%") != 1 {
+		return "", fmt.Errorf("%w: invalid path pattern %q", config.ErrProblemData, pattern)
+	}
+	name := fmt.Sprintf(pattern, index)
+	if util.CheckFileName(name) != nil {
+		return "", fmt.Errorf("%w: invalid path pattern %q", config.ErrProblemData, pattern)
+	}
+	return name, nil
+}
+
+// program picks the language by the extension of the source, Polygon names
+// the compiler in the type, e.g. cpp.g++17
+func (prog *polygonProgram) program(include []string) (ProgramConfig, error) {
+	program := ProgramConfig{Source: prog.Source.Path, Include: include}
+	language, ok := config.LanguageByExtension(path.Ext(program.Source))
+	if !ok {
+		return program, fmt.Errorf("%w: no language for %s (%s)", config.ErrProblemData, program.Source, prog.Source.Type)
+	}
+	program.Language = language
+	return program, program.check()
+}
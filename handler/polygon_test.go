@@ -0,0 +1,124 @@
+package handler_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/handler"
+)
+
+const polygonProblemXML = `<?xml version="1.0" encoding="utf-8" standalone="no"?>
+<problem revision="3" short-name="a-plus-b">
+    <judging cpu-name="Intel(R) Core(TM) i3-8100 CPU @ 3.60GHz" cpu-speed="3600" input-file="" output-file="">
+        <testset name="tests">
+            <time-limit>2000</time-limit>
+            <memory-limit>268435456</memory-limit>
+            <test-count>3</test-count>
+            <input-path-pattern>tests/%02d</input-path-pattern>
+            <answer-path-pattern>tests/%02d.a</answer-path-pattern>
+            <tests>
+                <test group="0" method="manual" points="0.0" sample="true"/>
+                <test cmd="gen 1" group="1" method="generated" points="20.0"/>
+                <test cmd="gen 2" group="1" method="generated" points="30.0"/>
+            </tests>
+            <groups>
+                <group feedback-policy="complete" name="0" points="0.0" points-policy="complete-group"/>
+                <group feedback-policy="icpc" name="1" points-policy="each-test">
+                    <dependencies>
+                        <dependency group="0"/>
+                    </dependencies>
+                </group>
+            </groups>
+        </testset>
+    </judging>
+    <files>
+        <resources>
+            <file path="files/olymp.sty"/>
+            <file path="files/testlib.h" type="h.g++"/>
+        </resources>
+    </files>
+    <assets>
+        <checker name="std::ncmp.cpp" type="testlib">
+            <source path="files/check.cpp" type="cpp.g++17"/>
+            <binary path="check.exe" type="exe.win32"/>
+        </checker>
+        <interactor>
+            <source path="files/interactor.cpp" type="cpp.g++17"/>
+        </interactor>
+        <validators>
+            <validator>
+                <source path="files/val.cpp" type="cpp.g++17"/>
+            </validator>
+        </validators>
+    </assets>
+</problem>
+`
+
+func TestLoadPolygonPackage(t *testing.T) {
+	config.DataFilesPath = t.TempDir()
+	config.Languages = map[string]config.LanguageConfig{
+		"cpp": {Source: "main.cpp", Exec: "main", Run: []string{"./main"}, Extensions: []string{".cpp"}},
+	}
+	problemPath := filepath.Join(config.DataFilesPath, "a-plus-b")
+	writeFiles(t, problemPath, map[string]string{
+		"problem.xml":          polygonProblemXML,
+		"tests/01":             "1 2\n",
+		"tests/01.a":           "3\n",
+		"tests/02":             "2 3\n",
+		"tests/02.a":           "5\n",
+		"tests/03":             "3 4\n",
+		"tests/03.a":           "7\n",
+		"files/testlib.h":      "",
+		"files/check.cpp":      "",
+		"files/interactor.cpp": "",
+		"files/val.cpp":        "",
+	})
+
+	p, err := handler.ReadProblem("a-plus-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.TestCases) != 3 {
+		t.Fatalf("got %d test cases, want 3", len(p.TestCases))
+	}
+	if p.TestCases[1].Input != filepath.Join(problemPath, "tests", "02") || p.TestCases[1].Output != filepath.Join(problemPath, "tests", "02.a") {
+		t.Errorf("test files should be used where they are: %+v", p.TestCases[1])
+	}
+	if !p.TestCases[0].Sample || p.TestCases[2].Group != "1" || p.TestCases[2].Points != 30 {
+		t.Errorf("got test cases %+v", p.TestCases)
+	}
+	if len(p.Groups) != 2 || p.Groups[1].Policy != "each-test" || len(p.Groups[1].Dependencies) != 1 {
+		t.Errorf("got groups %+v", p.Groups)
+	}
+	if p.Limits.Time != 2000 || p.Limits.Memory != 256<<20 {
+		t.Errorf("got limits %+v", p.Limits)
+	}
+	checker := p.Judge.Checker
+	if !p.CustomChecker || checker == nil || checker.Source != "files/check.cpp" || checker.Type != config.CheckerTypeTestlib {
+		t.Fatalf("got checker %+v", checker)
+	}
+	if len(checker.Include) != 1 || checker.Include[0] != "files/testlib.h" {
+		t.Errorf("headers in resources should be included: %v", checker.Include)
+	}
+	if p.Interactor == nil || p.Interactor.Source != "files/interactor.cpp" {
+		t.Errorf("got interactor %+v", p.Interactor)
+	}
+	if len(p.InputValidators) != 1 || p.InputValidators[0].Source != "files/val.cpp" {
+		t.Errorf("got validators %+v", p.InputValidators)
+	}
+	if p.Judge.FileIO != nil {
+		t.Errorf("empty file names are stdin and stdout: %+v", p.Judge.FileIO)
+	}
+
+	writeFiles(t, problemPath, map[string]string{
+		"problem.xml": strings.Replace(polygonProblemXML, `input-file="" output-file=""`, `input-file="apb.in" output-file=""`, 1),
+	})
+	if p, err = handler.ReadProblem("a-plus-b"); err != nil {
+		t.Fatal(err)
+	}
+	if p.Judge.FileIO == nil || p.Judge.FileIO.Input != "apb.in" || p.Judge.FileIO.Output != "" {
+		t.Errorf("got file io %+v", p.Judge.FileIO)
+	}
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -14,24 +15,158 @@ import (
 	"golang.org/x/sys/unix"
 )
 
-func prepareCodeFile(fileDesc model.SourceCodeDescriptor, filePath string) error {
-	fileRealPath := filepath.Join(filePath, fileDesc.Name)
-	return os.WriteFile(fileRealPath, []byte(fileDesc.Content), 0644)
+// requestError is a violation of the request found while it is handled,
+// it is answered as a bad request
+type requestError struct {
+	field string
+	err   error
 }
 
-func deleteCodeFile(fileDesc model.SourceCodeDescriptor, filePath string) error {
-	fileRealPath := filepath.Join(filePath, fileDesc.Name)
-	return os.Remove(fileRealPath)
+func (e *requestError) Error() string {
+	return e.field + ": " + e.err.Error()
 }
 
-func prepareContainer(phase model.Phase, readOnly bool) (libcontainer.Container, error) {
+func (e *requestError) Unwrap() error {
+	return e.err
+}
+
+// fieldError blames field for the errors caused by the request
+func fieldError(field string, err error) error {
+	if errors.Is(err, config.ErrInvalidRequest) {
+		return &requestError{field, err}
+	}
+	return err
+}
+
+func prepareCodeFiles(phase model.CompilePhase, filePath string) error {
+	w := util.SourceWriter{Dir: filePath}
+	if phase.SourceCode.Name != "" {
+		err := w.Write(phase.SourceCode.Name, strings.NewReader(phase.SourceCode.Content))
+		if err != nil {
+			return fieldError("compile_phases.code", err)
+		}
+	}
+	for i, fileDesc := range phase.SourceCodes {
+		err := w.Write(fileDesc.Name, strings.NewReader(fileDesc.Content))
+		if err != nil {
+			return fieldError(fmt.Sprintf("compile_phases.codes[%d]", i), err)
+		}
+	}
+	if phase.Archive != nil {
+		err := w.Extract(*phase.Archive)
+		if err != nil {
+			return fieldError("compile_phases.archive", err)
+		}
+	}
+	if len(w.Files) == 0 {
+		return fieldError("compile_phases.codes", fmt.Errorf("%w: no source file", config.ErrInvalidRequest))
+	}
+	return nil
+}
+
+// Move the declared artifacts from srcPath to dstPath, returns a message for
+// the user when they are missing
+func collectArtifacts(phase model.CompilePhase, compiled bool, srcPath string, dstPath string) (string, error) {
+	names := make([]string, 0)
+	if phase.ExecName != "" {
+		execPath := filepath.Join(srcPath, filepath.FromSlash(phase.ExecName))
+		stat, err := os.Lstat(execPath)
+		if err != nil || !stat.Mode().IsRegular() || hasSymlink(srcPath, filepath.FromSlash(phase.ExecName)) {
+			return "executable file " + phase.ExecName + " is not found", nil
+		}
+		if compiled && stat.Mode().Perm()&0111 == 0 {
+			return "file " + phase.ExecName + " is not executable", nil
+		}
+		names = append(names, filepath.FromSlash(phase.ExecName))
+	}
+	for _, pattern := range phase.Artifacts {
+		matches, err := filepath.Glob(filepath.Join(srcPath, filepath.FromSlash(pattern)))
+		if err != nil {
+			return "", errors.New("invalid artifact pattern: " + pattern)
+		}
+		for _, match := range matches {
+			stat, err := os.Lstat(match)
+			if err != nil || stat.Mode()&os.ModeSymlink != 0 {
+				continue
+			}
+			name, err := filepath.Rel(srcPath, match)
+			if err != nil {
+				return "", err
+			}
+			// the glob follows directories the build may have linked out of srcPath
+			if hasSymlink(srcPath, name) {
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "no artifact matches " + strings.Join(phase.Artifacts, ", "), nil
+	}
+	for _, name := range names {
+		dst := filepath.Join(dstPath, name)
+		if _, err := os.Lstat(dst); err == nil {
+			continue
+		}
+		err := os.MkdirAll(filepath.Dir(dst), 0755)
+		if err != nil {
+			util.ErrorLog(err, "collectArtifacts(): mkdir")
+			return "", err
+		}
+		err = os.Rename(filepath.Join(srcPath, name), dst)
+		if err != nil {
+			util.ErrorLog(err, "collectArtifacts(): move artifact")
+			return "", err
+		}
+	}
+	return "", nil
+}
+
+// hasSymlink tells whether name leaves root or any of its components under
+// root is a symlink, it is also true when a component cannot be read
+func hasSymlink(root string, name string) bool {
+	name = filepath.Clean(name)
+	if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+		return true
+	}
+	path := root
+	for _, component := range strings.Split(name, string(filepath.Separator)) {
+		path = filepath.Join(path, component)
+		stat, err := os.Lstat(path)
+		if err != nil || stat.Mode()&os.ModeSymlink != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnlyBind mounts a file of the host at destination in the rootfs, it
+// cannot be executed
+func readOnlyBind(source string, destination string) *configs.Mount {
+	return &configs.Mount{
+		Source:      source,
+		Destination: destination,
+		Device:      "bind",
+		Flags:       unix.MS_BIND | unix.MS_RDONLY | unix.MS_NOSUID | unix.MS_NODEV | unix.MS_NOEXEC,
+	}
+}
+
+// programBind is readOnlyBind for a program, which may be executed
+func programBind(source string, destination string) *configs.Mount {
+	mount := readOnlyBind(source, destination)
+	mount.Flags &^= unix.MS_NOEXEC
+	return mount
+}
+
+func prepareContainer(phase model.Phase, readOnly bool, mounts ...*configs.Mount) (libcontainer.Container, error) {
 	id, err := util.GenToken(20)
 	if err != nil {
 		return nil, err
 	}
 	conf := config.BaseConfig
+	// containers run at the same time, each has its own cgroup for limits and OOM accounting
 	cgroupsConfig := &configs.Cgroup{
-		Name:   "test-container",
+		Name:   id,
 		Parent: "system",
 		Resources: &configs.Resources{
 			MemorySwappiness:  nil,
@@ -41,14 +176,17 @@ func prepareContainer(phase model.Phase, readOnly bool) (libcontainer.Container,
 		},
 	}
 	if readOnly {
-		conf.ReadonlyPaths = append(conf.ReadonlyPaths, "/")
+		conf.ReadonlyPaths = append(append([]string{}, conf.ReadonlyPaths...), "/")
+	}
+	if len(mounts) != 0 {
+		conf.Mounts = append(append([]*configs.Mount{}, conf.Mounts...), mounts...)
 	}
 	conf.Cgroups = cgroupsConfig
 	stackLimit := phase.Limits.Memory
 	if phase.Limits.Stack != nil {
 		stackLimit = *phase.Limits.Stack
 	}
-	conf.Rlimits = append(conf.Rlimits, configs.Rlimit{
+	conf.Rlimits = append(append([]configs.Rlimit{}, conf.Rlimits...), configs.Rlimit{
 		Type: unix.RLIMIT_STACK,
 		Hard: uint64(stackLimit),
 		Soft: uint64(stackLimit),
@@ -56,32 +194,77 @@ func prepareContainer(phase model.Phase, readOnly bool) (libcontainer.Container,
 	return config.Factory.Create(id, &conf)
 }
 
+// PrepareTestCases scans a problem of the data source, a remote problem stays
+// in its folder until the cache evicts it
 func PrepareTestCases(problemID string) ([]model.TestCase, bool, error) {
-	testCasesPath := filepath.Join(config.DataFilesPath, problemID)
-	ls, err := os.ReadDir(testCasesPath)
+	dir, release, err := dataSource.Hold(problemID)
 	if err != nil {
-		util.ErrorLog(err, "PrepareTestCases(): read directory")
 		return nil, false, err
 	}
-	allFilesName := make(map[string]bool, 0)
-	testCasesInput := make(map[string]bool, 0)
-	customChecker := false
+	defer release()
+	problem := &Problem{ID: problemID, Path: dir}
+	err = problem.scanTestCases()
+	if err != nil {
+		return nil, false, err
+	}
+	if len(problem.TestCases) == 0 {
+		err := errors.New("problemID: " + problemID + ": no test cases")
+		util.ErrorLog(err, "PrepareTestCases(): find answer file")
+		return nil, false, err
+	}
+	return problem.TestCases, problem.CustomChecker, nil
+}
+
+// scanTestCases finds N.in with N.out or N.ans at the top of the problem
+// folder, or at the top of its data archive
+func (p *Problem) scanTestCases() error {
+	ls, err := os.ReadDir(p.Path)
+	if err != nil {
+		util.ErrorLog(err, "scanTestCases(): read directory")
+		return err
+	}
+	names := make([]string, 0)
 	for _, f := range ls {
 		if f.Type().IsRegular() {
-			fileFullName := f.Name()
-			allFilesName[fileFullName] = true
-			fileExt := filepath.Ext(fileFullName)
-			fileName := strings.TrimSuffix(fileFullName, fileExt)
-			if fileExt == ".in" {
-				testCasesInput[fileName] = true
+			names = append(names, f.Name())
+			if f.Name() == "spj.cpp" || f.Name() == "spj" {
+				p.CustomChecker = true
 			}
-			if fileFullName == "spj.cpp" {
-				customChecker = true
+		}
+	}
+	dataPath := p.Path
+	p.Archive = findDataArchive(p.Path)
+	if p.Archive != "" {
+		for _, name := range names {
+			if filepath.Ext(name) == ".in" {
+				err := fmt.Errorf("%w: problemID: %s: both %s and %s", config.ErrProblemData, p.ID, filepath.Base(p.Archive), name)
+				util.ErrorLog(err, "scanTestCases(): find data archive")
+				return err
 			}
 		}
+		if names, err = p.archiveTestCaseNames(); err != nil {
+			util.ErrorLog(err, "scanTestCases(): read data archive")
+			return err
+		}
+		dataPath = filepath.Join(dataCacheRoot(), p.dataKey)
+	}
+	p.TestCases, err = matchTestCases(dataPath, names)
+	return err
+}
+
+// matchTestCases pairs every N.in in names with N.out or N.ans in dir
+func matchTestCases(dir string, names []string) ([]model.TestCase, error) {
+	allFilesName := make(map[string]bool, 0)
+	testCasesInput := make([]string, 0)
+	for _, fileFullName := range names {
+		allFilesName[fileFullName] = true
+		fileExt := filepath.Ext(fileFullName)
+		if fileExt == ".in" {
+			testCasesInput = append(testCasesInput, strings.TrimSuffix(fileFullName, fileExt))
+		}
 	}
 	testCases := make([]model.TestCase, 0)
-	for inputName := range testCasesInput {
+	for _, inputName := range testCasesInput {
 		outputExt := ""
 		if _, ok := allFilesName[inputName+".out"]; ok {
 			outputExt = ".out"
@@ -89,25 +272,20 @@ func PrepareTestCases(problemID string) ([]model.TestCase, bool, error) {
 		if _, ok := allFilesName[inputName+".ans"]; ok {
 			if outputExt != "" {
 				err := errors.New("cannot recognise answer file: multipile answer file")
-				util.ErrorLog(err, "PrepareTestCases(): find answer file")
-				return nil, false, err
+				util.ErrorLog(err, "scanTestCases(): find answer file")
+				return nil, err
 			}
 			outputExt = ".ans"
 		}
 		if outputExt == "" {
 			err := errors.New("cannot recognise answer file: no answer file")
-			util.ErrorLog(err, "PrepareTestCases(): find answer file")
-			return nil, false, err
+			util.ErrorLog(err, "scanTestCases(): find answer file")
+			return nil, err
 		}
 		testCases = append(testCases, model.TestCase{
-			Input:  filepath.Join(testCasesPath, inputName+".in"),
-			Output: filepath.Join(testCasesPath, inputName+outputExt),
+			Input:  filepath.Join(dir, inputName+".in"),
+			Output: filepath.Join(dir, inputName+outputExt),
 		})
 	}
-	if len(testCases) == 0 {
-		err := errors.New("problemID: " + problemID + ": no test cases")
-		util.ErrorLog(err, "PrepareTestCases(): find answer file")
-		return nil, false, err
-	}
-	return testCases, customChecker, nil
+	return testCases, nil
 }
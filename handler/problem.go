@@ -0,0 +1,424 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+	"github.com/opencontainers/runc/libcontainer/configs"
+	"gopkg.in/yaml.v3"
+)
+
+const judgeConfigName = "judge.yaml"
+
+// Problem is everything the worker knows about a problem in DataFilesPath.
+// Limits are declared by problem packages, 0 when unknown. They replace the
+// run limits a request leaves at 0. InputValidators check every input file.
+// DataVersion is the hash of the verified data, requests may pin it.
+// Archive is the data archive of the problem, its test cases are extracted
+// into dataCache and must be held while they are read.
+type Problem struct {
+	ID              string
+	Path            string
+	Archive         string
+	dataKey         string
+	DataVersion     string
+	TestCases       []model.TestCase
+	Groups          []TestGroup
+	CustomChecker   bool
+	Judge           JudgeConfig
+	Limits          config.LimitsConfig
+	InputValidators []ValidatorConfig
+	Interactor      *ProgramConfig
+}
+
+// TestGroup is a group with points in a Polygon package, Policy is
+// "each-test" or "complete-group"
+type TestGroup struct {
+	Name         string
+	Points       float64
+	Policy       string
+	Dependencies []string
+}
+
+// JudgeConfig is read from judge.yaml in the problem directory, all fields are
+// optional. InvalidInput is reject or warn, it defaults to reject. FileIO
+// makes submissions read and write files, requests may override it.
+type JudgeConfig struct {
+	Checker      *CheckerConfig    `yaml:"checker"`
+	Validators   []ValidatorConfig `yaml:"validators"`
+	InvalidInput string            `yaml:"invalid_input"`
+	Generate     *GenerateConfig   `yaml:"generate"`
+	FileIO       *model.FileIO     `yaml:"file_io"`
+}
+
+// CheckerConfig without source only changes how fecmp or spj is run. Type is
+// testlib or kattis. Args may refer to the files as {input}, {output},
+// {answer} and {feedback}.
+type CheckerConfig struct {
+	ProgramConfig `yaml:",inline"`
+	Type          string              `yaml:"type"`
+	Limits        config.LimitsConfig `yaml:"limits"`
+	Args          []string            `yaml:"args"`
+	Files         CheckerFiles        `yaml:"files"`
+	// the files of the built checker, mounted into its work directory
+	mounts []*configs.Mount
+}
+
+// The names of the files in the work directory of the checker
+type CheckerFiles struct {
+	Input    string `yaml:"input"`
+	Output   string `yaml:"output"`
+	Answer   string `yaml:"answer"`
+	Feedback string `yaml:"feedback"`
+}
+
+var DefaultCheckerFiles = CheckerFiles{
+	Input:    "input",
+	Output:   "user_out",
+	Answer:   "answer",
+	Feedback: "feedback",
+}
+
+var defaultCheckerArgs = map[string][]string{
+	config.CheckerTypeTestlib: {"{input}", "{output}", "{answer}"},
+	config.CheckerTypeKattis:  {"{input}", "{answer}", "{feedback}"},
+}
+
+// ProgramConfig describes a program shipped with a problem. Language picks
+// an entry in the worker's languages, the other fields override it. Include
+// files are put next to the source when it is built, e.g. headers.
+type ProgramConfig struct {
+	Source   string     `yaml:"source"`
+	Language string     `yaml:"language"`
+	Compile  [][]string `yaml:"compile"`
+	Exec     string     `yaml:"exec"`
+	Run      []string   `yaml:"run"`
+	Include  []string   `yaml:"include"`
+}
+
+var IDProblemMap map[string]*Problem
+var idProblemMapMu sync.Mutex
+
+// failedProblems cannot be loaded from their folder, requests for them get
+// the error until the problem is in another folder
+var failedProblems map[string]failedProblem
+
+type failedProblem struct {
+	path string
+	err  error
+}
+
+// problemUnavailable must be called with idProblemMapMu held
+func problemUnavailable(problemID string, path string, err error) error {
+	if failedProblems == nil {
+		failedProblems = make(map[string]failedProblem, 0)
+	}
+	failedProblems[problemID] = failedProblem{path, err}
+	return fmt.Errorf("problemID: %s is unavailable: %w", problemID, err)
+}
+
+// holdProblem returns a problem of dataSource and keeps its folder until
+// release is called. Problems not loaded yet, or fetched again into another
+// folder, are loaded here.
+func holdProblem(problemID string) (*Problem, func(), error) {
+	dir, release, err := dataSource.Hold(problemID)
+	if err != nil {
+		return nil, nil, err
+	}
+	idProblemMapMu.Lock()
+	defer idProblemMapMu.Unlock()
+	if problem, ok := IDProblemMap[problemID]; ok && problem.Path == dir {
+		return problem, release, nil
+	}
+	if failed, ok := failedProblems[problemID]; ok && failed.path == dir {
+		release()
+		return nil, nil, fmt.Errorf("problemID: %s is unavailable: %w", problemID, failed.err)
+	}
+	problem, err := loadProblem(problemID, dir)
+	if err != nil {
+		release()
+		return nil, nil, problemUnavailable(problemID, dir, err)
+	}
+	delete(failedProblems, problemID)
+	if IDProblemMap == nil {
+		IDProblemMap = make(map[string]*Problem, 0)
+	}
+	IDProblemMap[problemID] = problem
+	return problem, release, nil
+}
+
+// LoadProblem reads a problem, verifies its data, generates test cases and
+// validates the inputs
+func LoadProblem(problemID string) (*Problem, error) {
+	return loadProblem(problemID, filepath.Join(config.DataFilesPath, problemID))
+}
+
+func loadProblem(problemID string, problemPath string) (*Problem, error) {
+	problem, err := readProblem(problemID, problemPath)
+	if err != nil {
+		return nil, err
+	}
+	err = problem.verifyData()
+	if err != nil {
+		util.ErrorLog(err, "LoadProblem(): verify data")
+		return nil, err
+	}
+	err = problem.generateTests()
+	if err != nil {
+		util.ErrorLog(err, "LoadProblem(): generate test cases")
+		return nil, err
+	}
+	err = problem.validateInputs()
+	if err != nil {
+		util.ErrorLog(err, "LoadProblem(): validate inputs")
+		return nil, err
+	}
+	return problem, nil
+}
+
+// ReadProblem reads a problem without running any program
+func ReadProblem(problemID string) (*Problem, error) {
+	return readProblem(problemID, filepath.Join(config.DataFilesPath, problemID))
+}
+
+func readProblem(problemID string, problemPath string) (*Problem, error) {
+	if err := util.CheckProblemID(problemID); err != nil {
+		return nil, err
+	}
+	problem := &Problem{
+		ID:   problemID,
+		Path: problemPath,
+	}
+	var err error
+	if isICPCPackage(problem.Path) {
+		err = problem.loadICPCPackage()
+	} else if isPolygonPackage(problem.Path) {
+		err = problem.loadPolygonPackage()
+	} else {
+		err = problem.scanTestCases()
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = problem.loadJudgeConfig()
+	if err != nil {
+		util.ErrorLog(err, "ReadProblem(): load "+judgeConfigName)
+		return nil, err
+	}
+	if len(problem.TestCases) == 0 && (problem.Judge.Generate == nil || len(problem.Judge.Generate.commands) == 0) {
+		err := fmt.Errorf("%w: problemID: %s: no test cases", config.ErrProblemData, problemID)
+		util.ErrorLog(err, "ReadProblem()")
+		return nil, err
+	}
+	return problem, nil
+}
+
+func (p *Problem) loadJudgeConfig() error {
+	b, err := os.ReadFile(filepath.Join(p.Path, judgeConfigName))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	judge := JudgeConfig{}
+	if err = yaml.Unmarshal(b, &judge); err != nil {
+		return fmt.Errorf("%w: %s: %s", config.ErrProblemData, judgeConfigName, err.Error())
+	}
+	// judge.yaml replaces the checker of a problem package
+	if judge.Checker != nil {
+		if err = judge.Checker.check(); err != nil {
+			return err
+		}
+		p.Judge.Checker = judge.Checker
+		if judge.Checker.Source != "" {
+			p.CustomChecker = true
+		}
+	}
+	// and so do its validators
+	if judge.Validators != nil {
+		for i := range judge.Validators {
+			if err = judge.Validators[i].check(); err != nil {
+				return err
+			}
+		}
+		p.InputValidators = judge.Validators
+	}
+	switch judge.InvalidInput {
+	case "", config.InvalidInputReject, config.InvalidInputWarn:
+	default:
+		return fmt.Errorf("%w: invalid_input must be %s or %s", config.ErrProblemData, config.InvalidInputReject, config.InvalidInputWarn)
+	}
+	p.Judge.InvalidInput = judge.InvalidInput
+	if judge.FileIO != nil {
+		if err = util.CheckFileIO(*judge.FileIO); err != nil {
+			return fmt.Errorf("%w: file_io: %s", config.ErrProblemData, err.Error())
+		}
+		p.Judge.FileIO = judge.FileIO
+	}
+	if judge.Generate != nil {
+		if err = judge.Generate.check(p.Path); err != nil {
+			return err
+		}
+		p.Judge.Generate = judge.Generate
+	}
+	return nil
+}
+
+func (c *CheckerConfig) check() error {
+	if c.Source != "" {
+		if err := c.ProgramConfig.check(); err != nil {
+			return err
+		}
+	}
+	switch c.Type {
+	case "", config.CheckerTypeTestlib, config.CheckerTypeKattis:
+	default:
+		return fmt.Errorf("%w: unknown checker type %s", config.ErrProblemData, c.Type)
+	}
+	if c.Limits.Time < 0 || c.Limits.Memory < 0 {
+		return fmt.Errorf("%w: checker limits must not be negative", config.ErrProblemData)
+	}
+	for _, name := range []string{c.Files.Input, c.Files.Output, c.Files.Answer, c.Files.Feedback} {
+		if name != "" && util.CheckFileName(name) != nil {
+			return fmt.Errorf("%w: invalid checker file name %q", config.ErrProblemData, name)
+		}
+	}
+	return nil
+}
+
+// checkerConfig fills the default settings of the checker
+func (p *Problem) checkerConfig() CheckerConfig {
+	c := CheckerConfig{}
+	if p.Judge.Checker != nil {
+		c = *p.Judge.Checker
+	}
+	if c.Limits.Time == 0 {
+		c.Limits.Time = config.ToolTimeLimit
+	}
+	if c.Limits.Memory == 0 {
+		c.Limits.Memory = config.ToolMemoryLimit
+	}
+	if c.Type == "" {
+		c.Type = config.CheckerTypeTestlib
+	}
+	if c.Args == nil {
+		c.Args = defaultCheckerArgs[c.Type]
+	}
+	if c.Files.Input == "" {
+		c.Files.Input = DefaultCheckerFiles.Input
+	}
+	if c.Files.Output == "" {
+		c.Files.Output = DefaultCheckerFiles.Output
+	}
+	if c.Files.Answer == "" {
+		c.Files.Answer = DefaultCheckerFiles.Answer
+	}
+	if c.Files.Feedback == "" {
+		c.Files.Feedback = DefaultCheckerFiles.Feedback
+	}
+	return c
+}
+
+func DefaultCheckerConfig() CheckerConfig {
+	return (&Problem{}).checkerConfig()
+}
+
+func (c *CheckerConfig) runArgs(program []string) []string {
+	replacer := strings.NewReplacer("{input}", c.Files.Input, "{output}", c.Files.Output,
+		"{answer}", c.Files.Answer, "{feedback}", c.Files.Feedback+"/")
+	args := append([]string{}, program...)
+	for _, arg := range c.Args {
+		args = append(args, replacer.Replace(arg))
+	}
+	return args
+}
+
+func (p *ProgramConfig) check() error {
+	if util.CheckFileName(p.Source) != nil {
+		return fmt.Errorf("%w: invalid source %q", config.ErrProblemData, p.Source)
+	}
+	for _, name := range p.Include {
+		if util.CheckFileName(name) != nil {
+			return fmt.Errorf("%w: invalid file %q", config.ErrProblemData, name)
+		}
+	}
+	for _, args := range p.Compile {
+		if len(args) == 0 {
+			return fmt.Errorf("%w: empty compile command of %s", config.ErrProblemData, p.Source)
+		}
+	}
+	_, err := p.resolve()
+	return err
+}
+
+func (p *ProgramConfig) resolve() (config.LanguageConfig, error) {
+	lang := config.LanguageConfig{}
+	if p.Language != "" {
+		preset, ok := config.Languages[p.Language]
+		if !ok {
+			return lang, fmt.Errorf("%w: unknown language %s", config.ErrProblemData, p.Language)
+		}
+		lang = preset
+	}
+	if lang.Source == "" {
+		lang.Source = filepath.Base(p.Source)
+	}
+	if p.Compile != nil {
+		lang.Compile = p.Compile
+	}
+	if p.Exec != "" {
+		lang.Exec = p.Exec
+	}
+	if p.Run != nil {
+		lang.Run = p.Run
+	}
+	if len(lang.Run) == 0 {
+		return lang, fmt.Errorf("%w: no run arguments for %s", config.ErrProblemData, p.Source)
+	}
+	return lang, nil
+}
+
+// build returns the directory holding the built program and how to run it
+// from that directory. testlib.h in DataFilesPath is always available, Include
+// files of the same name win.
+func (p *ProgramConfig) build(problemPath string) (string, []string, error) {
+	lang, err := p.resolve()
+	if err != nil {
+		return "", nil, err
+	}
+	extraFiles := make([]string, 0)
+	testlib := filepath.Join(config.DataFilesPath, "testlib.h")
+	if _, err := os.Stat(testlib); err == nil {
+		extraFiles = append(extraFiles, testlib)
+	}
+	for _, name := range p.Include {
+		extraFiles = append(extraFiles, filepath.Join(problemPath, filepath.FromSlash(name)))
+	}
+	dir, err := buildTool(lang, filepath.Join(problemPath, filepath.FromSlash(p.Source)), extraFiles...)
+	if err != nil {
+		return "", nil, err
+	}
+	return dir, lang.Run, nil
+}
+
+func (p *Problem) hasCheckerProgram() bool {
+	return p.Judge.Checker != nil && p.Judge.Checker.Source != ""
+}
+
+// checkerProgram is the checker in judge.yaml, or spj.cpp built as C++
+func (p *Problem) checkerProgram() *ProgramConfig {
+	if p.hasCheckerProgram() {
+		return &p.Judge.Checker.ProgramConfig
+	}
+	return &ProgramConfig{
+		Source:   "spj.cpp",
+		Language: "cpp",
+	}
+}
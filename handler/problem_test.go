@@ -0,0 +1,186 @@
+package handler_test
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/handler"
+)
+
+func TestReadProblemValidators(t *testing.T) {
+	config.DataFilesPath = t.TempDir()
+	config.Languages = map[string]config.LanguageConfig{
+		"cpp": {Source: "main.cpp", Exec: "main", Run: []string{"./main"}, Extensions: []string{".cpp"}},
+	}
+	writeFiles(t, filepath.Join(config.DataFilesPath, "1"), map[string]string{
+		"1.in":          "1\n",
+		"1.out":         "1\n",
+		"validator.cpp": "",
+	})
+	p, err := handler.ReadProblem("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.InputValidators) != 0 {
+		t.Errorf("validator.cpp should only run when judge.yaml lists it: %+v", p.InputValidators)
+	}
+
+	writeFiles(t, filepath.Join(config.DataFilesPath, "1"), map[string]string{
+		"judge.yaml": "validators: [{source: validator.cpp, language: cpp}]\n",
+	})
+	if p, err = handler.ReadProblem("1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.InputValidators) != 1 || p.InputValidators[0].Source != "validator.cpp" {
+		t.Errorf("judge.yaml should list validator.cpp: %+v", p.InputValidators)
+	}
+
+	writeFiles(t, filepath.Join(config.DataFilesPath, "1"), map[string]string{
+		"judge.yaml": "validators: []\ninvalid_input: warn\n",
+	})
+	if p, err = handler.ReadProblem("1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.InputValidators) != 0 || p.Judge.InvalidInput != config.InvalidInputWarn {
+		t.Errorf("judge.yaml should replace the validators: %+v", p.InputValidators)
+	}
+
+	writeFiles(t, filepath.Join(config.DataFilesPath, "1"), map[string]string{
+		"judge.yaml": "file_io: {input: 'apb.in', output: 'apb.out'}\n",
+	})
+	if p, err = handler.ReadProblem("1"); err != nil {
+		t.Fatal(err)
+	}
+	if p.Judge.FileIO == nil || p.Judge.FileIO.Input != "apb.in" || p.Judge.FileIO.Output != "apb.out" {
+		t.Errorf("got file io %+v", p.Judge.FileIO)
+	}
+	writeFiles(t, filepath.Join(config.DataFilesPath, "1"), map[string]string{
+		"judge.yaml": "file_io: {input: '../apb.in'}\n",
+	})
+	if _, err = handler.ReadProblem("1"); err == nil {
+		t.Error("file_io with a path should be rejected")
+	}
+
+	writeFiles(t, filepath.Join(config.DataFilesPath, "1"), map[string]string{
+		"judge.yaml": "invalid_input: ignore\n",
+	})
+	if _, err = handler.ReadProblem("1"); err == nil {
+		t.Error("unknown invalid_input should be rejected")
+	}
+
+	writeFiles(t, filepath.Join(config.DataFilesPath, "1"), map[string]string{
+		"judge.yaml": "validators: [{source: validator.cpp, language: cpp, compile: [[]]}]\n",
+	})
+	if _, err = handler.ReadProblem("1"); err == nil {
+		t.Error("empty compile command should be rejected")
+	}
+}
+
+func TestReadProblemGenerate(t *testing.T) {
+	config.DataFilesPath = t.TempDir()
+	config.Languages = map[string]config.LanguageConfig{
+		"cpp": {Source: "main.cpp", Exec: "main", Run: []string{"./main"}, Extensions: []string{".cpp"}},
+	}
+	writeFiles(t, filepath.Join(config.DataFilesPath, "gen"), map[string]string{
+		"gen.cpp":    "",
+		"std.cpp":    "",
+		"script.txt": "# small\ngen 10 1\n\ngen 100 2 # large\n",
+		"judge.yaml": "generate:\n  generators:\n    - {name: gen, source: gen.cpp, language: cpp}\n  solution: {source: std.cpp, language: cpp}\n  script: script.txt\n  tests: ['gen 1 0']\n",
+	})
+	if _, err := handler.ReadProblem("gen"); err != nil {
+		t.Fatalf("generated test cases should be enough: %v", err)
+	}
+
+	writeFiles(t, filepath.Join(config.DataFilesPath, "gen"), map[string]string{
+		"script.txt": "rand 10 1\n",
+	})
+	if _, err := handler.ReadProblem("gen"); err == nil {
+		t.Error("commands should name a generator")
+	}
+
+	writeFiles(t, filepath.Join(config.DataFilesPath, "empty"), map[string]string{
+		"judge.yaml": "generate:\n  solution: {source: std.cpp, language: cpp}\n",
+		"std.cpp":    "",
+	})
+	if _, err := handler.ReadProblem("empty"); err == nil {
+		t.Error("a problem without test cases should be rejected")
+	}
+}
+
+func TestReadProblemArchive(t *testing.T) {
+	config.DataFilesPath = t.TempDir()
+	config.CacheFilesPath = t.TempDir()
+	problemPath := filepath.Join(config.DataFilesPath, "zip")
+	writeFiles(t, problemPath, map[string]string{"spj.cpp": ""})
+	f, err := os.Create(filepath.Join(problemPath, "data.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{"1.in", "1.ans", "2.in", "2.out", "sub/3.in"} {
+		w, _ := zw.Create(name)
+		w.Write([]byte(name))
+	}
+	zw.Close()
+	f.Close()
+
+	p, err := handler.ReadProblem("zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.TestCases) != 2 || !p.CustomChecker || p.Archive != filepath.Join(problemPath, "data.zip") {
+		t.Fatalf("unexpected problem: %+v", p)
+	}
+	for _, testCase := range p.TestCases {
+		if !strings.HasPrefix(testCase.Input, filepath.Join(config.CacheFilesPath, "data")) {
+			t.Errorf("test case should be in the data cache: %s", testCase.Input)
+		}
+	}
+	if _, err = handler.WriteManifest("zip"); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := util.ReadManifest(filepath.Join(problemPath, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Files) != 2 || manifest.Files[0].Path != "data.zip" || manifest.Files[1].Path != "spj.cpp" {
+		t.Errorf("manifest should list every file of the problem: %+v", manifest.Files)
+	}
+	if _, err = handler.ReadProblem("zip"); err != nil {
+		t.Errorf("problem with its own manifest should load: %v", err)
+	}
+
+	writeFiles(t, problemPath, map[string]string{"4.in": "", "4.out": ""})
+	if _, err = handler.ReadProblem("zip"); err == nil {
+		t.Error("loose test cases next to an archive should be rejected")
+	}
+}
+
+func TestLoadProblemsFailed(t *testing.T) {
+	config.DataFilesPath = t.TempDir()
+	config.CacheFilesPath = t.TempDir()
+	config.DataSource = config.DataSourceConfig{}
+	config.MemoryCacheSize = 0
+	writeFiles(t, config.DataFilesPath, map[string]string{
+		"fecmp":          "",
+		"ok/1.in":        "1\n",
+		"ok/1.out":       "1\n",
+		"bad/1.in":       "1\n",
+		"bad/1.out":      "1\n",
+		"bad/judge.yaml": "validators: [{source: validator.cpp, language: cobol}]\n",
+	})
+
+	handler.InitTestCases()
+	if _, ok := handler.IDProblemMap["ok"]; !ok {
+		t.Error("problems that load should be judged")
+	}
+	if _, ok := handler.IDProblemMap["bad"]; ok {
+		t.Error("problem that fails to load should be unavailable")
+	}
+}
@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+)
+
+// DataSource gives the folder of a problem and keeps it until release is
+// called. A problem that is fetched again may be in another folder.
+type DataSource interface {
+	Hold(problemID string) (string, func(), error)
+}
+
+var dataSource DataSource = localSource{}
+
+func initDataSource() {
+	if config.DataSource.Type == "" || config.DataSource.Type == config.DataSourceLocal {
+		dataSource = localSource{}
+		return
+	}
+	source, err := NewRemoteSource(config.DataSource, filepath.Join(config.CacheFilesPath, "remote"))
+	if err != nil {
+		util.ErrorLog(err, "initDataSource()")
+		panic(err)
+	}
+	dataSource = source
+}
+
+// localSource is DataFilesPath
+type localSource struct{}
+
+func (localSource) Hold(problemID string) (string, func(), error) {
+	if err := util.CheckProblemID(problemID); err != nil {
+		return "", nil, err
+	}
+	dir := filepath.Join(config.DataFilesPath, problemID)
+	if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+		return "", nil, errors.New("cannot find test cases for problemID: " + problemID)
+	}
+	return dir, func() {}, nil
+}
+
+// remoteSource downloads the files in <url>/<problemID>/manifest.json, every
+// problem is cached by its data version
+type remoteSource struct {
+	url      *url.URL
+	conf     config.DataSourceConfig
+	client   *http.Client
+	cache    *util.DirCache
+	mu       sync.Mutex
+	problems map[string]remoteProblem
+}
+
+// remoteProblem is the version of a problem the manifest named when it was
+// last checked, etag is empty when the server sends none
+type remoteProblem struct {
+	key     string
+	etag    string
+	checked time.Time
+}
+
+var errNotModified = errors.New("not modified")
+
+// NewRemoteSource makes an http or s3 source, cacheRoot holds the fetched problems
+func NewRemoteSource(conf config.DataSourceConfig, cacheRoot string) (DataSource, error) {
+	if conf.Type != config.DataSourceHTTP && conf.Type != config.DataSourceS3 {
+		return nil, errors.New("unknown data source type: " + conf.Type)
+	}
+	u, err := url.Parse(conf.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, errors.New("invalid data source url: " + conf.URL)
+	}
+	cache, err := util.NewDirCache(cacheRoot, conf.CacheSize)
+	if err != nil {
+		return nil, err
+	}
+	return &remoteSource{
+		url:      u,
+		conf:     conf,
+		client:   &http.Client{Timeout: config.DataSourceTimeout},
+		cache:    cache,
+		problems: make(map[string]remoteProblem, 0),
+	}, nil
+}
+
+// get returns the body and the ETag of a file, errNotModified when it still
+// has the given ETag
+func (s *remoteSource) get(problemID string, name string, etag string) (io.ReadCloser, string, error) {
+	u := s.url.JoinPath(problemID, name)
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if s.conf.Type == config.DataSourceS3 {
+		util.SignS3Request(req, s.conf.AccessKey, s.conf.SecretKey, s.conf.Region, time.Now())
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode == http.StatusNotModified && etag != "" {
+		resp.Body.Close()
+		return nil, "", errNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, "", fmt.Errorf("GET %s: %s", u.Redacted(), resp.Status)
+	}
+	return resp.Body, resp.Header.Get("ETag"), nil
+}
+
+func (s *remoteSource) Hold(problemID string) (string, func(), error) {
+	if err := util.CheckProblemID(problemID); err != nil {
+		return "", nil, err
+	}
+	s.mu.Lock()
+	cached, ok := s.problems[problemID]
+	s.mu.Unlock()
+	ttl := time.Duration(s.conf.ManifestTTL) * time.Second
+	if ok && time.Since(cached.checked) < ttl {
+		if dir, release, ok := s.cache.Hold(cached.key); ok {
+			return dir, release, nil
+		}
+	}
+
+	// the manifest may have changed since it was fetched
+	etag := ""
+	if ok {
+		etag = cached.etag
+	}
+	body, etag, err := s.get(problemID, manifestName, etag)
+	if err == errNotModified {
+		if dir, release, ok := s.cache.Hold(cached.key); ok {
+			cached.checked = time.Now()
+			s.mu.Lock()
+			s.problems[problemID] = cached
+			s.mu.Unlock()
+			return dir, release, nil
+		}
+		// evicted in the meantime, the manifest is needed to fetch it again
+		body, etag, err = s.get(problemID, manifestName, "")
+	}
+	if err != nil {
+		util.ErrorLog(err, "remoteSource.Hold(): fetch "+manifestName)
+		return "", nil, errors.New("cannot find test cases for problemID: " + problemID + ": " + err.Error())
+	}
+	b, err := io.ReadAll(io.LimitReader(body, config.MaxSourceTotalSize))
+	body.Close()
+	if err != nil {
+		return "", nil, err
+	}
+	manifest, err := util.ParseManifest(b)
+	if err != nil {
+		return "", nil, fmt.Errorf("problemID: %s: %w", problemID, err)
+	}
+	key := manifest.Version()
+	dir, release, err := s.cache.HoldOrPut(key, func(dir string) error {
+		for _, entry := range manifest.Files {
+			if err := s.download(problemID, entry, dir); err != nil {
+				return err
+			}
+		}
+		return os.WriteFile(filepath.Join(dir, manifestName), b, 0644)
+	})
+	if err != nil {
+		util.ErrorLog(err, "remoteSource.Hold(): fetch problem "+problemID)
+		return "", nil, err
+	}
+	s.mu.Lock()
+	s.problems[problemID] = remoteProblem{key: key, etag: etag, checked: time.Now()}
+	s.mu.Unlock()
+	return dir, release, nil
+}
+
+// download checks the size and hash of a file while writing it
+func (s *remoteSource) download(problemID string, entry util.ManifestEntry, dir string) error {
+	filePath := filepath.Join(dir, filepath.FromSlash(entry.Path))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	body, _, err := s.get(problemID, entry.Path, "")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), io.LimitReader(body, entry.Size+1))
+	if err != nil {
+		return err
+	}
+	if n != entry.Size {
+		return fmt.Errorf("%w: %s: size is %d, want %d", config.ErrProblemData, entry.Path, n, entry.Size)
+	}
+	if hex.EncodeToString(h.Sum(nil)) != entry.SHA256 {
+		return fmt.Errorf("%w: %s: checksum mismatch", config.ErrProblemData, entry.Path)
+	}
+	return nil
+}
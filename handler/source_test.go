@@ -0,0 +1,139 @@
+package handler_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/handler"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+)
+
+// writeRemoteManifest lists the other files in manifest.json
+func writeRemoteManifest(t *testing.T, files map[string]string) {
+	manifest := util.Manifest{}
+	for name, content := range files {
+		if name == "manifest.json" {
+			continue
+		}
+		sum := sha256.Sum256([]byte(content))
+		manifest.Files = append(manifest.Files, util.ManifestEntry{Path: name, Size: int64(len(content)), SHA256: hex.EncodeToString(sum[:])})
+	}
+	manifestPath := filepath.Join(t.TempDir(), "manifest.json")
+	if err := manifest.Write(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(manifestPath)
+	files["manifest.json"] = string(b)
+}
+
+func TestRemoteSource(t *testing.T) {
+	files := map[string]string{"1.in": "1 2\n", "1.out": "3\n", "sub/2.in": "4\n"}
+	writeRemoteManifest(t, files)
+
+	requests := int32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		content, ok := files[strings.TrimPrefix(r.URL.Path, "/bucket/problems/p1/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		sum := sha256.Sum256([]byte(content))
+		etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(content))
+	}))
+	defer srv.Close()
+
+	conf := config.DataSourceConfig{
+		Type:      config.DataSourceS3,
+		URL:       srv.URL + "/bucket/problems",
+		Region:    "us-east-1",
+		AccessKey: "minio",
+		SecretKey: "minio123",
+	}
+	source, err := handler.NewRemoteSource(conf, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, release, err := source.Hold("p1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if b, err := os.ReadFile(filepath.Join(dir, "sub", "2.in")); err != nil || string(b) != "4\n" {
+		t.Errorf("unexpected file %q: %v", b, err)
+	}
+	if requests != 4 {
+		t.Errorf("expected 4 requests, got %d", requests)
+	}
+	if _, release, err = source.Hold("p1"); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if requests != 5 {
+		t.Errorf("only the manifest of a cached problem should be checked, got %d requests", requests)
+	}
+	if _, _, err = source.Hold("p2"); err == nil {
+		t.Error("missing problem should be an error")
+	}
+
+	files["1.out"] = "5\n"
+	writeRemoteManifest(t, files)
+	if dir, release, err = source.Hold("p1"); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if b, err := os.ReadFile(filepath.Join(dir, "1.out")); err != nil || string(b) != "5\n" {
+		t.Errorf("changed manifest should fetch the new version, got %q: %v", b, err)
+	}
+
+	conf.ManifestTTL = 3600
+	if source, err = handler.NewRemoteSource(conf, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, release, err = source.Hold("p1"); err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	requests = 0
+	if _, release, err = source.Hold("p1"); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if requests != 0 {
+		t.Errorf("manifest should not be checked within its TTL, got %d requests", requests)
+	}
+	conf.ManifestTTL = 0
+
+	files["1.out"] = "6\n"
+	source, err = handler.NewRemoteSource(conf, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = source.Hold("p1"); err == nil {
+		t.Error("tampered file should be rejected")
+	}
+	conf.Type = "ftp"
+	if _, err = handler.NewRemoteSource(conf, t.TempDir()); err == nil {
+		t.Error("unknown type should be rejected")
+	}
+}
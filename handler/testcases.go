@@ -9,21 +9,21 @@ import (
 	"sync"
 
 	"github.com/HeRaNO/cdoj-execution-worker/config"
-	"github.com/HeRaNO/cdoj-execution-worker/model"
 	"github.com/HeRaNO/cdoj-execution-worker/util"
 )
 
-var IDTestCasesMap map[string][]model.TestCase
-var IDCustomCheckerMap map[string]bool
+// The caches of programs and results used when problems load
+func initProblemCaches() {
+	initToolCache()
+	initValidationCache()
+	initGeneratedCache()
+	initManifestCache()
+	initDataCache()
+}
 
 func InitTestCases() {
-	IDTestCasesMap = make(map[string][]model.TestCase, 0)
-	IDCustomCheckerMap = make(map[string]bool, 0)
-	problems, err := os.ReadDir(config.DataFilesPath)
-	if err != nil {
-		util.ErrorLog(err, "ReadDir()")
-		panic(err)
-	}
+	IDProblemMap = make(map[string]*Problem, 0)
+	failedProblems = make(map[string]failedProblem, 0)
 	fstat, err := os.Stat(filepath.Join(config.DataFilesPath, "fecmp")) // Check whether default checker exists
 	if err != nil {
 		util.ErrorLog(err, "PrepareTestCases(): read default checker")
@@ -34,36 +34,60 @@ func InitTestCases() {
 		util.ErrorLog(err, "PrepareTestCases(): read default checker")
 		panic(err)
 	}
+	initProblemCaches()
+	initDataSource()
+	initMemoryCache()
+	if _, ok := dataSource.(localSource); !ok {
+		log.Println("init test cases successully, problems are fetched on first use")
+		return
+	}
+	problems, err := os.ReadDir(config.DataFilesPath)
+	if err != nil {
+		util.ErrorLog(err, "ReadDir()")
+		panic(err)
+	}
 	wg := sync.WaitGroup{}
-	idTestCasesSyncMap := sync.Map{}
-	idCustomCheckerSyncMap := sync.Map{}
-	for i, problem := range problems {
+	idProblemSyncMap := sync.Map{}
+	failedSyncMap := sync.Map{}
+	workers := make(chan struct{}, config.LoadProblemWorkers)
+	for _, problem := range problems {
+		// e.g. .git or lost+found, requests cannot name them anyway
+		if problem.IsDir() && util.CheckProblemID(problem.Name()) != nil {
+			log.Printf("[WARN] skip folder %q in dataFilesPath: not a valid problem ID\n", problem.Name())
+			continue
+		}
 		wg.Add(1)
+		workers <- struct{}{}
 		go func(wg *sync.WaitGroup, problem fs.DirEntry) {
 			defer wg.Done()
+			defer func() { <-workers }()
 			if problem.IsDir() {
 				problemID := problem.Name()
-				testCase, customChecker, err := PrepareTestCases(problemID)
+				p, err := LoadProblem(problemID)
 				if err != nil {
-					util.ErrorLog(err, "PrepareTestCases for problem: "+problemID)
-					panic(err)
+					// the other problems are still judged
+					util.ErrorLog(err, "LoadProblem for problem: "+problemID)
+					failedSyncMap.Store(problemID, err)
+					return
 				}
-				idTestCasesSyncMap.Store(problemID, testCase)
-				idCustomCheckerSyncMap.Store(problemID, customChecker)
+				idProblemSyncMap.Store(problemID, p)
 			}
 		}(&wg, problem)
-		if i%1000 == 0 {
-			wg.Wait()
-		}
 	}
 	wg.Wait()
-	idTestCasesSyncMap.Range(func(key, value interface{}) bool {
-		IDTestCasesMap[key.(string)] = value.([]model.TestCase)
+	idProblemSyncMap.Range(func(key, value interface{}) bool {
+		IDProblemMap[key.(string)] = value.(*Problem)
 		return true
 	})
-	idCustomCheckerSyncMap.Range(func(key, value interface{}) bool {
-		IDCustomCheckerMap[key.(string)] = value.(bool)
+	failed := 0
+	failedSyncMap.Range(func(key, value interface{}) bool {
+		problemID := key.(string)
+		problemUnavailable(problemID, filepath.Join(config.DataFilesPath, problemID), value.(error))
+		failed++
 		return true
 	})
+	if failed != 0 {
+		log.Printf("[WARN] %d problems failed to load, requests for them are answered with the error\n", failed)
+	}
 	log.Println("init test cases successully")
 }
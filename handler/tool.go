@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+	"github.com/opencontainers/runc/libcontainer"
+)
+
+// Programs shipped with problems, e.g. checkers, are built once and kept here
+var toolCache *util.DirCache
+
+func initToolCache() {
+	cache, err := util.NewDirCache(filepath.Join(config.CacheFilesPath, "tools"), 0)
+	if err != nil {
+		util.ErrorLog(err, "initToolCache()")
+		panic(err)
+	}
+	toolCache = cache
+}
+
+// toolPhases are the compile steps of a language, each with limits
+func toolPhases(lang config.LanguageConfig, limits model.Limitation) []model.Phase {
+	steps := make([]model.Phase, 0)
+	for _, args := range lang.Compile {
+		steps = append(steps, model.Phase{
+			RunArgs: args,
+			Limits:  limits,
+		})
+	}
+	return steps
+}
+
+// buildTool compiles sourcePath in language lang along with extraFiles, and
+// returns the directory holding the executable. Of extra files with the same
+// name the last one is used. A compile error is a problem data error.
+func buildTool(lang config.LanguageConfig, sourcePath string, extraFiles ...string) (string, error) {
+	source, err := os.ReadFile(sourcePath)
+	if err != nil {
+		util.ErrorLog(err, "buildTool(): read source")
+		return "", fmt.Errorf("%w: cannot read %s", config.ErrProblemData, filepath.Base(sourcePath))
+	}
+	steps := toolPhases(lang, model.Limitation{Time: config.ToolTimeLimit, Memory: config.ToolMemoryLimit})
+	phase := model.CompilePhase{
+		SourceCodes: []model.SourceCodeDescriptor{{Name: lang.Source, Content: string(source)}},
+		Steps:       steps,
+		ExecName:    lang.Exec,
+	}
+	index := map[string]int{lang.Source: 0}
+	for _, extraFile := range extraFiles {
+		content, err := os.ReadFile(extraFile)
+		if err != nil {
+			util.ErrorLog(err, "buildTool(): read extra file")
+			return "", fmt.Errorf("%w: cannot read %s", config.ErrProblemData, filepath.Base(extraFile))
+		}
+		name := filepath.Base(extraFile)
+		if i, ok := index[name]; ok {
+			if i == 0 {
+				return "", fmt.Errorf("%w: %s is the name of the source", config.ErrProblemData, name)
+			}
+			phase.SourceCodes[i].Content = string(content)
+			continue
+		}
+		index[name] = len(phase.SourceCodes)
+		phase.SourceCodes = append(phase.SourceCodes, model.SourceCodeDescriptor{
+			Name:    name,
+			Content: string(content),
+		})
+	}
+	key := util.HashKey(struct {
+		Phase  model.CompilePhase
+		Run    []string
+		Rootfs string
+	}{phase, lang.Run, config.RootfsIdentity})
+	if dir, ok := toolCache.Get(key); ok {
+		return dir, nil
+	}
+
+	runDir, msg, parentPath, err := HandleCompilePhases(phase)
+	if parentPath != "" {
+		defer os.RemoveAll(filepath.Join(config.WorkDirGlobal, parentPath))
+	}
+	if err != nil {
+		return "", err
+	}
+	if !msg.Succeed {
+		errMsg := msg.Reason
+		if msg.ErrMsg != nil {
+			errMsg += "\n" + msg.ErrMsg.S
+		}
+		return "", fmt.Errorf("%w: cannot compile %s: %s", config.ErrProblemData, filepath.Base(sourcePath), errMsg)
+	}
+	return toolCache.Put(key, func(dir string) error {
+		return util.CopyDir(filepath.Join(config.WorkDirGlobal, runDir), dir)
+	})
+}
+
+// stageProgram keeps an executable copy of a prebuilt program, e.g. spj, as
+// name in a directory of toolCache until the program changes
+func stageProgram(programPath string, name string) (string, error) {
+	stat, err := os.Stat(programPath)
+	if err != nil {
+		return "", err
+	}
+	key := util.HashKey(struct {
+		Path    string
+		Name    string
+		Size    int64
+		ModTime int64
+	}{programPath, name, stat.Size(), stat.ModTime().UnixNano()})
+	if dir, ok := toolCache.Get(key); ok {
+		return dir, nil
+	}
+	return toolCache.Put(key, func(dir string) error {
+		return util.SafeCopy(programPath, filepath.Join(dir, name))
+	})
+}
+
+// toolPhase runs program with args, limits of 0 are the defaults of tools
+func toolPhase(program []string, args []string, limits config.LimitsConfig) model.Phase {
+	phase := model.Phase{
+		Exec:    program[0],
+		RunArgs: append(append([]string{}, program...), args...),
+		Limits: model.Limitation{
+			Time:   limits.Time,
+			Memory: limits.Memory,
+		},
+	}
+	if phase.Limits.Time == 0 {
+		phase.Limits.Time = config.ToolTimeLimit
+	}
+	if phase.Limits.Memory == 0 {
+		phase.Limits.Memory = config.ToolMemoryLimit
+	}
+	return phase
+}
+
+// runTool runs a built tool in workDir, stdinPath may be empty
+func runTool(phase model.Phase, workDir string, stdinPath string, stdout *os.File, stderr *os.File) (*model.ProcessResult, error) {
+	container, err := prepareContainer(phase, true)
+	if err != nil {
+		util.ErrorLog(err, "prepareContainer()")
+		return nil, errors.New("cannot init container: " + err.Error())
+	}
+	defer container.Destroy()
+	noNewPriv := true
+	process := &libcontainer.Process{
+		Args:            phase.RunArgs,
+		Env:             config.DefaultEnv,
+		User:            config.WorkUser,
+		Cwd:             filepath.Join(config.WorkDirInRootfs, workDir),
+		NoNewPrivileges: &noNewPriv,
+		Init:            true,
+	}
+	if stdinPath != "" {
+		inFile, err := os.Open(stdinPath)
+		if err != nil {
+			util.ErrorLog(err, "runTool(): open input file")
+			return nil, errors.New("cannot open input file: " + err.Error())
+		}
+		defer inFile.Close()
+		process.Stdin = inFile
+	}
+	if stdout != nil {
+		process.Stdout = stdout
+	}
+	if stderr != nil {
+		process.Stderr = stderr
+	}
+	return executeSingle(container, process, phase.Limits.Time)
+}
+
+// tempFile creates a file in CacheFilesPath, remove it when done
+func tempFile() (*os.File, error) {
+	fileName, err := util.GenToken(20)
+	if err != nil {
+		return nil, errors.New("cannot create temp file: " + err.Error())
+	}
+	f, err := os.OpenFile(filepath.Join(config.CacheFilesPath, fileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		util.ErrorLog(err, "tempFile(): open file")
+		return nil, errors.New("cannot create temp file: " + err.Error())
+	}
+	return f, nil
+}
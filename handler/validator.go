@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+	"github.com/goccy/go-json"
+)
+
+// Results of input validators are kept by the built validator and the hash of the input
+var validationCache *util.DirCache
+
+func initValidationCache() {
+	cache, err := util.NewDirCache(filepath.Join(config.CacheFilesPath, "validation"), 0)
+	if err != nil {
+		util.ErrorLog(err, "initValidationCache()")
+		panic(err)
+	}
+	validationCache = cache
+}
+
+// ValidatorConfig is a program which reads an input file on stdin. A testlib
+// validator exits with 0 for valid input, a kattis one with 42 and 43.
+type ValidatorConfig struct {
+	ProgramConfig `yaml:",inline"`
+	Type          string              `yaml:"type"`
+	Args          []string            `yaml:"args"`
+	Limits        config.LimitsConfig `yaml:"limits"`
+}
+
+type validationResult struct {
+	Valid   bool   `json:"valid"`
+	Message string `json:"msg"`
+}
+
+func (v *ValidatorConfig) check() error {
+	if err := v.ProgramConfig.check(); err != nil {
+		return err
+	}
+	switch v.Type {
+	case "", config.CheckerTypeTestlib, config.CheckerTypeKattis:
+	default:
+		return fmt.Errorf("%w: unknown validator type %s", config.ErrProblemData, v.Type)
+	}
+	if v.Limits.Time < 0 || v.Limits.Memory < 0 {
+		return fmt.Errorf("%w: validator limits must not be negative", config.ErrProblemData)
+	}
+	return nil
+}
+
+// validateInputs runs every input validator on every input file. Invalid
+// input fails the problem, or is only logged when judge.yaml says warn.
+func (p *Problem) validateInputs() error {
+	if len(p.InputValidators) == 0 {
+		return nil
+	}
+	release, err := p.holdData()
+	if err != nil {
+		return err
+	}
+	defer release()
+	hashes := make(map[string]string, 0)
+	for i := range p.InputValidators {
+		invalid, err := p.runInputValidator(&p.InputValidators[i], hashes)
+		if err != nil {
+			return err
+		}
+		for _, msg := range invalid {
+			if p.Judge.InvalidInput == config.InvalidInputWarn {
+				log.Printf("[WARN] problemID: %s: %s\n", p.ID, msg)
+				continue
+			}
+			return fmt.Errorf("%w: problemID: %s: %s", config.ErrProblemData, p.ID, msg)
+		}
+	}
+	return nil
+}
+
+func (p *Problem) runInputValidator(v *ValidatorConfig, hashes map[string]string) ([]string, error) {
+	toolDir, program, err := v.build(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	phase := toolPhase(program, v.Args, v.Limits)
+	workDir := ""
+	defer func() {
+		if workDir != "" {
+			os.RemoveAll(filepath.Join(config.WorkDirGlobal, workDir))
+		}
+	}()
+
+	invalid := make([]string, 0)
+	for _, testCase := range p.TestCases {
+		hash, ok := hashes[testCase.Input]
+		if !ok {
+			if hash, err = util.FileSHA256(testCase.Input); err != nil {
+				return nil, err
+			}
+			hashes[testCase.Input] = hash
+		}
+		key := validationCacheKey(filepath.Base(toolDir), phase, v.Type, hash)
+		res, ok := loadValidationResult(key)
+		if !ok {
+			if workDir == "" {
+				folderName, workPath, err := util.Mkdir(config.WorkDirGlobal)
+				if err != nil {
+					return nil, err
+				}
+				workDir = folderName
+				if err = util.CopyDir(toolDir, workPath); err != nil {
+					return nil, errors.New("cannot copy validator: " + err.Error())
+				}
+			}
+			res, err = runValidator(phase, v.Type, testCase.Input, workDir)
+			if err != nil {
+				return nil, fmt.Errorf("%w: validator %s on %s: %s", config.ErrProblemData, v.Source, testCase.Input, err.Error())
+			}
+			storeValidationResult(key, res)
+		}
+		if !res.Valid {
+			rel, _ := filepath.Rel(p.Path, testCase.Input)
+			invalid = append(invalid, fmt.Sprintf("%s rejects %s: %s", v.Source, rel, res.Message))
+		}
+	}
+	return invalid, nil
+}
+
+func validationCacheKey(tool string, phase model.Phase, validatorType string, inputHash string) string {
+	return util.HashKey(struct {
+		Tool  string
+		Phase model.Phase
+		Type  string
+		Input string
+	}{tool, phase, validatorType, inputHash})
+}
+
+func loadValidationResult(key string) (*validationResult, bool) {
+	dir, ok := validationCache.Get(key)
+	if !ok {
+		return nil, false
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "result.json"))
+	if err != nil {
+		util.ErrorLog(err, "loadValidationResult(): read result")
+		validationCache.Remove(key)
+		return nil, false
+	}
+	res := &validationResult{}
+	if err = json.Unmarshal(b, res); err != nil {
+		util.ErrorLog(err, "loadValidationResult(): unmarshal result")
+		validationCache.Remove(key)
+		return nil, false
+	}
+	return res, true
+}
+
+func storeValidationResult(key string, res *validationResult) {
+	_, err := validationCache.Put(key, func(dir string) error {
+		b, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, "result.json"), b, 0644)
+	})
+	if err != nil {
+		util.ErrorLog(err, "storeValidationResult()")
+	}
+}
+
+// runValidator gives the input on stdin and keeps stderr as the message. Time
+// and memory limits or crashes are errors rather than invalid input.
+func runValidator(phase model.Phase, validatorType string, inputPath string, workDir string) (*validationResult, error) {
+	errFile, err := tempFile()
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(errFile.Name())
+	defer errFile.Close()
+	state, err := runTool(phase, workDir, inputPath, nil, errFile)
+	if err != nil {
+		return nil, err
+	}
+	if state.Err == config.ErrTLE || state.Err == config.ErrOOM {
+		return nil, state.Err
+	}
+	res := &validationResult{}
+	exitCode := state.ProcessState.ExitCode()
+	switch {
+	case validatorType == config.CheckerTypeKattis && exitCode == config.KattisExitAC:
+		res.Valid = true
+	case validatorType == config.CheckerTypeKattis && exitCode == config.KattisExitWA:
+	case validatorType != config.CheckerTypeKattis && exitCode == 0:
+		res.Valid = true
+	case validatorType != config.CheckerTypeKattis && exitCode > 0:
+	default:
+		return nil, fmt.Errorf("exited with code %d", exitCode)
+	}
+	msg, err := util.LimitFileReader(errFile.Name(), config.OmitStringLen)
+	if err != nil {
+		return nil, errors.New("cannot read errFile: " + err.Error())
+	}
+	if msg != nil {
+		res.Message = msg.S
+	}
+	return res, nil
+}
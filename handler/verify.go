@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+	"github.com/goccy/go-json"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// Solutions are tagged by their folder, e.g. solutions/TLE/brute.cpp
+const solutionsFolderName = "solutions"
+
+var verdictTags = []string{"AC", "WA", "TLE", "MLE", "RE"}
+
+// SolutionReport is the verdict of a tagged solution. Time is the slowest
+// test case of an accepted solution in ns.
+type SolutionReport struct {
+	Source   string
+	Expected string
+	Actual   string
+	Time     int64
+	Message  string
+}
+
+func (r SolutionReport) Matched() bool {
+	return r.Expected == r.Actual
+}
+
+// VerifyProblem loads a problem of the data source and judges every tagged solution with Judge.
+// Limits of 0 are those of the problem. It also returns a suggested time
+// limit in ms, twice the slowest accepted solution, 0 without one.
+func VerifyProblem(problemID string, limits config.LimitsConfig) ([]SolutionReport, int32, error) {
+	initProblemCaches()
+	initDataSource()
+	initMemoryCache()
+	problem, release, err := holdProblem(problemID)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer release()
+	if limits.Time == 0 {
+		limits.Time = problem.Limits.Time
+	}
+	if limits.Time == 0 {
+		return nil, 0, fmt.Errorf("problemID: %s: no time limit", problemID)
+	}
+	if limits.Memory == 0 {
+		limits.Memory = problem.Limits.Memory
+	}
+	if limits.Memory == 0 {
+		limits.Memory = config.ToolMemoryLimit
+	}
+
+	reports := make([]SolutionReport, 0)
+	slowest := int64(0)
+	for _, tag := range verdictTags {
+		ls, err := os.ReadDir(filepath.Join(problem.Path, solutionsFolderName, tag))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, f := range ls {
+			if !f.Type().IsRegular() {
+				continue
+			}
+			report := problem.verifySolution(path.Join(solutionsFolderName, tag, f.Name()), limits)
+			report.Expected = tag
+			if report.Actual == "AC" && report.Time > slowest {
+				slowest = report.Time
+			}
+			reports = append(reports, report)
+		}
+	}
+	sort.SliceStable(reports, func(i, j int) bool {
+		return reports[i].Source < reports[j].Source
+	})
+	// twice the slowest, rounded up to 100 ms
+	suggested := (slowest*2/1e6 + 99) / 100 * 100
+	return reports, int32(suggested), nil
+}
+
+func (p *Problem) verifySolution(source string, limits config.LimitsConfig) SolutionReport {
+	report := SolutionReport{Source: source}
+	language, ok := config.LanguageByExtension(path.Ext(source))
+	if !ok {
+		report.Message = "no language for " + path.Ext(source)
+		return report
+	}
+	lang := config.Languages[language]
+	content, err := os.ReadFile(filepath.Join(p.Path, filepath.FromSlash(source)))
+	if err != nil {
+		report.Message = err.Error()
+		return report
+	}
+	if len(lang.Run) == 0 {
+		report.Message = "no run arguments for " + language
+		return report
+	}
+	// solutions are compiled like submissions, with the largest limits
+	steps := toolPhases(lang, model.Limitation{
+		Time:   config.MaxTimeLimit,
+		Memory: config.MaxMemoryLimit,
+	})
+	checkPhase := config.CheckMethodWcmp
+	if p.CustomChecker {
+		checkPhase = config.CheckMethodSpj
+	}
+	req := model.ExecRequest{
+		CompilePhases: model.CompilePhase{
+			Steps:       steps,
+			SourceCodes: []model.SourceCodeDescriptor{{Name: lang.Source, Content: string(content)}},
+			ExecName:    lang.Exec,
+		},
+		RunPhases: model.RunPhase{
+			Run: model.Phase{
+				Exec:    lang.Run[0],
+				RunArgs: lang.Run,
+				Limits: model.Limitation{
+					Time:   limits.Time,
+					Memory: limits.Memory,
+				},
+			},
+			ProblemID: p.ID,
+		},
+		CheckPhase: checkPhase,
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		panic(err)
+	}
+	var final model.Response
+	Judge(body, source, func(resp amqp091.Publishing) {
+		r := model.Response{}
+		if json.Unmarshal(resp.Body, &r) == nil && !(r.ErrCode == model.OK && r.ErrMsg == util.MsgRunning) {
+			final = r
+		}
+	})
+	report.Actual, report.Time = verdictOf(final)
+	if report.Actual != "AC" && report.Actual != "WA" {
+		report.Message = final.ErrMsg
+	}
+	return report
+}
+
+func verdictOf(resp model.Response) (string, int64) {
+	switch resp.ErrCode {
+	case model.CE:
+		return "CE", 0
+	case model.BR:
+		return "BR", 0
+	case model.RE:
+		switch resp.ErrMsg {
+		case config.ErrTLE.Error():
+			return "TLE", 0
+		case config.ErrOOM.Error():
+			return "MLE", 0
+		}
+		return "RE", 0
+	case model.OK:
+		switch resp.ErrMsg {
+		case util.MsgWrongAnswer:
+			return "WA", 0
+		case util.MsgNoOutput:
+			return "NO", 0
+		}
+		res := model.ExecResult{}
+		if err := json.Unmarshal([]byte(resp.Data), &res); err != nil {
+			return "IE", 0
+		}
+		return "AC", res.UserTimeUsed
+	}
+	return "IE", 0
+}
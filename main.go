@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"github.com/HeRaNO/cdoj-execution-worker/config"
 	"github.com/HeRaNO/cdoj-execution-worker/handler"
@@ -11,8 +14,27 @@ import (
 
 func main() {
 	initConfigFile := flag.String("c", "./config.yaml", "the path of configure file")
+	verifyProblem := flag.String("verify", "", "judge the tagged solutions of a problem and exit")
+	timeLimit := flag.Int("tl", 0, "the time limit in ms used by -verify, default to the limit of the problem")
+	manifestProblem := flag.String("manifest", "", "write manifest.json with the files of a problem folder and exit")
+	flag.Parse()
+	if *manifestProblem != "" {
+		config.InitConfig(initConfigFile)
+		version, err := handler.WriteManifest(*manifestProblem)
+		if err != nil {
+			log.Fatalln("[FAILED] write manifest failed:", err)
+		}
+		fmt.Println("data version:", version)
+		return
+	}
+	if *verifyProblem != "" {
+		config.InitConfig(initConfigFile)
+		config.InitContainer()
+		os.Exit(verify(*verifyProblem, int32(*timeLimit)))
+	}
 	channel, msgQ := config.Init(initConfigFile)
 	handler.InitTestCases()
+	handler.InitCompileCache()
 	for req := range msgQ {
 		ctx := context.Background()
 		handler.HandleReq(ctx, req, channel)
@@ -20,3 +42,35 @@ func main() {
 
 	log.Panicln("[FATAL] Why execute this line???")
 }
+
+// verify prints the verdict of every solution, it returns 1 when any verdict is unexpected
+func verify(problemID string, timeLimit int32) int {
+	reports, suggested, err := handler.VerifyProblem(problemID, config.LimitsConfig{Time: timeLimit})
+	if err != nil {
+		log.Println("[FAILED] verify problem failed:", err)
+		return 1
+	}
+	exitCode := 0
+	for _, report := range reports {
+		status := "ok"
+		if !report.Matched() {
+			status = "MISMATCH"
+			exitCode = 1
+		}
+		line := fmt.Sprintf("%-8s %s: expected %s, got %s", status, report.Source, report.Expected, report.Actual)
+		if report.Actual == "AC" {
+			line += fmt.Sprintf(" in %v", time.Duration(report.Time).Round(time.Millisecond))
+		}
+		if report.Message != "" {
+			line += " (" + report.Message + ")"
+		}
+		fmt.Println(line)
+	}
+	if len(reports) == 0 {
+		fmt.Println("no solutions found in solutions/<AC|WA|TLE|MLE|RE>/")
+	}
+	if suggested > 0 {
+		fmt.Printf("suggested time limit: %d ms\n", suggested)
+	}
+	return exitCode
+}
@@ -7,4 +7,5 @@ const (
 	CE
 	IE
 	RE
+	BR
 )
@@ -10,10 +10,12 @@ type Limitation struct {
 	Stack  *int64 `json:"stack,omitempty"`
 }
 
+// Diagnostics names the parser of the compiler output, e.g. "gcc"
 type Phase struct {
-	Exec    string     `json:"exec"`
-	RunArgs []string   `json:"run_args"`
-	Limits  Limitation `json:"limits"`
+	Exec        string     `json:"exec"`
+	RunArgs     []string   `json:"run_args"`
+	Limits      Limitation `json:"limits"`
+	Diagnostics string     `json:"diagnostics,omitempty"`
 }
 
 type SourceCodeDescriptor struct {
@@ -21,30 +23,66 @@ type SourceCodeDescriptor struct {
 	Content string `json:"content"`
 }
 
+const (
+	ArchiveZip   = "zip"
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+)
+
+// Content is base64 encoded
+type ArchiveDescriptor struct {
+	Format  string `json:"format"`
+	Content string `json:"content"`
+}
+
 type CompilePhase struct {
-	Compile    Phase                `json:"compile"`
-	SourceCode SourceCodeDescriptor `json:"code"`
-	ExecName   string               `json:"exec_name"`
+	Compile     *Phase                 `json:"compile,omitempty"`
+	Steps       []Phase                `json:"steps,omitempty"`
+	SyntaxCheck *Phase                 `json:"syntax_check,omitempty"`
+	SourceCode  SourceCodeDescriptor   `json:"code"`
+	SourceCodes []SourceCodeDescriptor `json:"codes,omitempty"`
+	Archive     *ArchiveDescriptor     `json:"archive,omitempty"`
+	ExecName    string                 `json:"exec_name"`
+	Artifacts   []string               `json:"artifacts,omitempty"`
+	LogLimit    int64                  `json:"log_limit,omitempty"`
 }
 
+// FileIO names the files the program reads and writes in its work directory
+// instead of stdin and stdout, an empty name keeps the standard stream
+type FileIO struct {
+	Input  string `json:"input" yaml:"input"`
+	Output string `json:"output" yaml:"output"`
+}
+
+// DataVersion pins the data version of the problem when it is set. FileIO
+// overrides the one of the problem.
 type RunPhase struct {
-	Run       Phase  `json:"run"`
-	ProblemID string `json:"pid"`
+	Run         Phase   `json:"run"`
+	ProblemID   string  `json:"pid"`
+	DataVersion string  `json:"data_version,omitempty"`
+	FileIO      *FileIO `json:"file_io,omitempty"`
 }
 
+// CheckLogLimit caps the checker message and the Kattis feedback files like
+// CompilePhase.LogLimit caps the compile log, 0 is the default of the worker
 type ExecRequest struct {
 	CompilePhases CompilePhase `json:"compile_phases"`
 	RunPhases     RunPhase     `json:"run_phases"`
 	CheckPhase    string       `json:"check_phase"`
+	CheckLogLimit int64        `json:"check_log_limit,omitempty"`
 }
 
 type ExecResult struct {
 	Case          int32       `json:"case"`
+	Group         string      `json:"group,omitempty"`
 	ExitCode      int         `json:"exit_code"`
 	UserTimeUsed  int64       `json:"user_time"`
 	SysTimeUsed   int64       `json:"sys_time"`
 	MemoryUsed    int64       `json:"memory"`
 	CheckerResult *OmitString `json:"checker_res"`
+	CompileLog    *CompileLog `json:"compile_log,omitempty"`
+	JudgeMessage  *OmitString `json:"judge_msg,omitempty"`
+	TeamMessage   *OmitString `json:"team_msg,omitempty"`
 }
 
 type Response struct {
@@ -53,9 +91,20 @@ type Response struct {
 	Data    string    `json:"data"`
 }
 
+type FieldError struct {
+	Field string `json:"field"`
+	Msg   string `json:"msg"`
+}
+
+// Group is the folder of the test case in an ICPC package, e.g. "secret/group1",
+// or the group name in a Polygon package. Points are given by Polygon packages.
+// Sample is informational, samples are judged like the other test cases.
 type TestCase struct {
 	Input  string
 	Output string
+	Group  string
+	Sample bool
+	Points float64
 }
 
 type ProcessResult struct {
@@ -68,7 +117,46 @@ type OmitString struct {
 	OmitSize int64  `json:"omit_size"`
 }
 
+const (
+	CompileReasonTLE   = "compilation time limit"
+	CompileReasonOOM   = "compiler out of memory"
+	CompileReasonCrash = "compiler crashed"
+)
+
+// ErrMsg holds the compile log, which carries warnings when succeed
 type CompileResult struct {
-	Succeed bool
-	ErrMsg  *OmitString
+	Succeed     bool
+	Step        int
+	Reason      string
+	Time        int64
+	Memory      int64
+	ErrMsg      *OmitString
+	Diagnostics []Diagnostic
+}
+
+// Message is the output of the checker, the others come from Kattis output validators
+type CheckerResult struct {
+	Accepted     bool
+	Message      *OmitString
+	JudgeMessage *OmitString
+	TeamMessage  *OmitString
+}
+
+type Diagnostic struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column,omitempty"`
+	Severity string `json:"severity"`
+	Message  string `json:"msg"`
+}
+
+// Step is 1-based and refers to the step which produced the log, 0 is the syntax check
+// Time is in nanoseconds and Memory is in KiB, the same as ExecResult
+type CompileLog struct {
+	*OmitString
+	Step        int          `json:"step"`
+	Reason      string       `json:"reason,omitempty"`
+	Time        int64        `json:"time"`
+	Memory      int64        `json:"memory"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
 }
@@ -0,0 +1,162 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Archive files are told apart by name, .tar.zst needs zstd in PATH
+func archiveFormat(archivePath string) string {
+	switch {
+	case strings.HasSuffix(archivePath, ".zip"):
+		return "zip"
+	case strings.HasSuffix(archivePath, ".tar"):
+		return "tar"
+	case strings.HasSuffix(archivePath, ".tar.gz"), strings.HasSuffix(archivePath, ".tgz"):
+		return "tar.gz"
+	case strings.HasSuffix(archivePath, ".tar.zst"):
+		return "tar.zst"
+	}
+	return ""
+}
+
+// cmdReader is the output of a decompressor, the exit status is checked by
+// Close once the output is read to the end
+type cmdReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr bytes.Buffer
+	eof    bool
+}
+
+func (r *cmdReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+func (r *cmdReader) Close() error {
+	if !r.eof {
+		// stopped early, the caller already has an error
+		r.cmd.Process.Kill()
+	}
+	err := r.cmd.Wait()
+	if r.eof && err != nil {
+		return errors.New("cannot decompress archive: " + err.Error() + ": " + strings.TrimSpace(r.stderr.String()))
+	}
+	return nil
+}
+
+// closeTar reads what follows the end of the tar archive, so that the
+// decompressor finishes on its own and its errors are not lost
+func closeTar(r io.ReadCloser) error {
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		r.Close()
+		return errors.New("cannot read tar archive: " + err.Error())
+	}
+	return r.Close()
+}
+
+// openTar decompresses a tar archive as a stream
+func openTar(archivePath string) (io.ReadCloser, error) {
+	switch archiveFormat(archivePath) {
+	case "tar":
+		return os.Open(archivePath)
+	case "tar.gz":
+		f, err := os.Open(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, errors.New("cannot decompress archive: " + err.Error())
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{gr, f}, nil
+	case "tar.zst":
+		r := &cmdReader{cmd: exec.Command("zstd", "-dcq", archivePath)}
+		r.cmd.Stderr = &r.stderr
+		stdout, err := r.cmd.StdoutPipe()
+		if err != nil {
+			return nil, err
+		}
+		if err = r.cmd.Start(); err != nil {
+			return nil, errors.New("cannot run zstd: " + err.Error())
+		}
+		r.ReadCloser = stdout
+		return r, nil
+	}
+	return nil, errors.New("unknown archive format: " + archivePath)
+}
+
+// ArchiveEntries lists the regular files in an archive without extracting it
+func ArchiveEntries(archivePath string) ([]string, error) {
+	names := make([]string, 0)
+	if archiveFormat(archivePath) == "zip" {
+		zr, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return nil, errors.New("cannot open zip archive: " + err.Error())
+		}
+		defer zr.Close()
+		for _, f := range zr.File {
+			if f.Mode().IsRegular() {
+				names = append(names, entryName(f.Name))
+			}
+		}
+		return names, nil
+	}
+	r, err := openTar(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			if err = closeTar(r); err != nil {
+				return nil, err
+			}
+			return names, nil
+		}
+		if err != nil {
+			r.Close()
+			return nil, errors.New("cannot read tar archive: " + err.Error())
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			names = append(names, entryName(hdr.Name))
+		}
+	}
+}
+
+// ExtractFile extracts an archive file by its name, e.g. data.tar.zst
+func (w *SourceWriter) ExtractFile(archivePath string) error {
+	if archiveFormat(archivePath) == "zip" {
+		zr, err := zip.OpenReader(archivePath)
+		if err != nil {
+			return errors.New("cannot open zip archive: " + err.Error())
+		}
+		defer zr.Close()
+		return w.extractZip(&zr.Reader)
+	}
+	r, err := openTar(archivePath)
+	if err != nil {
+		return err
+	}
+	if err = w.extractTar(r); err != nil {
+		r.Close()
+		return err
+	}
+	return closeTar(r)
+}
@@ -0,0 +1,116 @@
+package util_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+)
+
+// the contents are what tarArchive writes for the sizes
+var archiveFiles = map[string]string{"1.in": "aaa", "1.out": "a", "sub/2.in": "aaaa"}
+
+// writeArchive writes the zip or tar of archiveFiles to path, gzipped when gz is set
+func writeArchive(t *testing.T, path string, format string, gz bool) {
+	var a model.ArchiveDescriptor
+	if format == model.ArchiveZip {
+		a = zipArchive(t, archiveFiles, "")
+	} else {
+		hdrs := []*tar.Header{{Name: "sub/", Typeflag: tar.TypeDir, Mode: 0755}}
+		for name, content := range archiveFiles {
+			hdrs = append(hdrs, &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))})
+		}
+		a = tarArchive(t, hdrs)
+	}
+	b, err := base64.StdEncoding.DecodeString(a.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gz {
+		buf := bytes.Buffer{}
+		zw := gzip.NewWriter(&buf)
+		zw.Write(b)
+		zw.Close()
+		b = buf.Bytes()
+	}
+	if err = os.WriteFile(path, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchiveFile(t *testing.T) {
+	dir := t.TempDir()
+	writeArchive(t, filepath.Join(dir, "data.zip"), model.ArchiveZip, false)
+	writeArchive(t, filepath.Join(dir, "data.tar"), model.ArchiveTar, false)
+	writeArchive(t, filepath.Join(dir, "data.tar.gz"), model.ArchiveTar, true)
+	archives := []string{"data.zip", "data.tar", "data.tar.gz"}
+	if _, err := exec.LookPath("zstd"); err == nil {
+		err = exec.Command("zstd", "-q", filepath.Join(dir, "data.tar"), "-o", filepath.Join(dir, "data.tar.zst")).Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		archives = append(archives, "data.tar.zst")
+	}
+
+	for _, name := range archives {
+		archivePath := filepath.Join(dir, name)
+		entries, err := util.ArchiveEntries(archivePath)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		sort.Strings(entries)
+		if len(entries) != 3 || entries[0] != "1.in" || entries[2] != "sub/2.in" {
+			t.Errorf("%s: unexpected entries %v", name, entries)
+		}
+		w := util.SourceWriter{Dir: t.TempDir(), Unlimited: true}
+		if err := w.ExtractFile(archivePath); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		b, err := os.ReadFile(filepath.Join(w.Dir, "sub", "2.in"))
+		if err != nil || string(b) != archiveFiles["sub/2.in"] {
+			t.Errorf("%s: extracted %q, %v", name, b, err)
+		}
+	}
+
+	if _, err := util.ArchiveEntries(filepath.Join(dir, "data.rar")); err == nil {
+		t.Error("unknown format should be rejected")
+	}
+	os.WriteFile(filepath.Join(dir, "bad.tar.gz"), []byte("not gzip"), 0644)
+	if _, err := util.ArchiveEntries(filepath.Join(dir, "bad.tar.gz")); err == nil {
+		t.Error("corrupt archive should be rejected")
+	}
+}
+
+func TestArchiveFileZstdError(t *testing.T) {
+	if _, err := exec.LookPath("zstd"); err != nil {
+		t.Skip("zstd is not installed")
+	}
+	dir := t.TempDir()
+	writeArchive(t, filepath.Join(dir, "data.tar"), model.ArchiveTar, false)
+	archivePath := filepath.Join(dir, "data.tar.zst")
+	if err := exec.Command("zstd", "-q", "--check", filepath.Join(dir, "data.tar"), "-o", archivePath).Run(); err != nil {
+		t.Fatal(err)
+	}
+	// the whole tar decompresses, only the checksum at the end is wrong
+	b, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-1] ^= 0xff
+	os.WriteFile(archivePath, b, 0644)
+	if _, err := util.ArchiveEntries(archivePath); err == nil {
+		t.Error("zstd error should be reported")
+	}
+	w := util.SourceWriter{Dir: t.TempDir(), Unlimited: true}
+	if err := w.ExtractFile(archivePath); err == nil {
+		t.Error("zstd error should be reported")
+	}
+}
@@ -0,0 +1,240 @@
+package util
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const tmpPrefix = ".tmp-"
+
+type cacheEntry struct {
+	size  int64
+	used  time.Time
+	holds int
+}
+
+// DirCache stores directories under root by key and evicts the least recently
+// used ones when their total size exceeds maxSize, 0 means no limit
+type DirCache struct {
+	root    string
+	maxSize int64
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	size    int64
+}
+
+func dirSize(path string) int64 {
+	size := int64(0)
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err == nil && d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+func NewDirCache(root string, maxSize int64) (*DirCache, error) {
+	err := os.MkdirAll(root, 0755)
+	if err != nil {
+		ErrorLog(err, "NewDirCache(): mkdir")
+		return nil, err
+	}
+	ls, err := os.ReadDir(root)
+	if err != nil {
+		ErrorLog(err, "NewDirCache(): read directory")
+		return nil, err
+	}
+	c := &DirCache{
+		root:    root,
+		maxSize: maxSize,
+		entries: make(map[string]*cacheEntry, 0),
+	}
+	for _, f := range ls {
+		path := filepath.Join(root, f.Name())
+		if strings.HasPrefix(f.Name(), tmpPrefix) || !f.IsDir() {
+			os.RemoveAll(path)
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		entry := &cacheEntry{size: dirSize(path), used: info.ModTime()}
+		c.entries[f.Name()] = entry
+		c.size += entry.size
+	}
+	c.mu.Lock()
+	c.evict("")
+	c.mu.Unlock()
+	return c, nil
+}
+
+func (c *DirCache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	path := filepath.Join(c.root, key)
+	entry.used = time.Now()
+	os.Chtimes(path, entry.used, entry.used)
+	return path, true
+}
+
+// Hold is Get that also keeps the entry from being evicted until release is called
+func (c *DirCache) Hold(key string) (string, func(), bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", nil, false
+	}
+	path := filepath.Join(c.root, key)
+	entry.used = time.Now()
+	entry.holds++
+	os.Chtimes(path, entry.used, entry.used)
+	var once sync.Once
+	return path, func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			entry.holds--
+			if c.entries[key] == entry {
+				c.evict("")
+			}
+		})
+	}, true
+}
+
+// Put fills a fresh directory and stores it as key, an existing entry wins
+func (c *DirCache) Put(key string, fill func(dir string) error) (string, error) {
+	if key == "" || strings.ContainsRune(key, filepath.Separator) || strings.HasPrefix(key, ".") {
+		return "", errors.New("invalid cache key: " + key)
+	}
+	token, err := GenToken(20)
+	if err != nil {
+		return "", err
+	}
+	tmpPath := filepath.Join(c.root, tmpPrefix+token)
+	err = os.Mkdir(tmpPath, 0755)
+	if err != nil {
+		ErrorLog(err, "DirCache.Put(): mkdir")
+		return "", err
+	}
+	err = fill(tmpPath)
+	if err != nil {
+		os.RemoveAll(tmpPath)
+		return "", err
+	}
+	size := dirSize(tmpPath)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	path := filepath.Join(c.root, key)
+	if entry, ok := c.entries[key]; ok {
+		os.RemoveAll(tmpPath)
+		entry.used = time.Now()
+		return path, nil
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		ErrorLog(err, "DirCache.Put(): rename")
+		os.RemoveAll(tmpPath)
+		return "", err
+	}
+	c.entries[key] = &cacheEntry{size: size, used: time.Now()}
+	c.size += size
+	c.evict(key)
+	return path, nil
+}
+
+// HoldOrPut holds key and fills it first when it is not cached. Another key may
+// evict it between Put and Hold, so that is retried a few times.
+func (c *DirCache) HoldOrPut(key string, fill func(dir string) error) (string, func(), error) {
+	for i := 0; i < 3; i++ {
+		if path, release, ok := c.Hold(key); ok {
+			return path, release, nil
+		}
+		if _, err := c.Put(key, fill); err != nil {
+			return "", nil, err
+		}
+	}
+	return "", nil, errors.New("cache entry is evicted while it is filled: " + key)
+}
+
+func (c *DirCache) Remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(key)
+}
+
+func (c *DirCache) remove(key string) {
+	entry, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	os.RemoveAll(filepath.Join(c.root, key))
+	c.size -= entry.size
+	delete(c.entries, key)
+}
+
+// evict must be called with mu held, keep and held entries are never evicted
+func (c *DirCache) evict(keep string) {
+	if c.maxSize <= 0 || c.size <= c.maxSize {
+		return
+	}
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].used.Before(c.entries[keys[j]].used)
+	})
+	for _, key := range keys {
+		if c.size <= c.maxSize {
+			return
+		}
+		if key != keep && c.entries[key].holds == 0 {
+			c.remove(key)
+		}
+	}
+}
+
+// CopyDir copies regular files and directories from src into dst, keeping permissions
+func CopyDir(src string, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		err = SafeCopy(path, target)
+		if err != nil {
+			return err
+		}
+		return os.Chmod(target, info.Mode().Perm())
+	})
+}
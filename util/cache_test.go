@@ -0,0 +1,138 @@
+package util_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+)
+
+func putFile(t *testing.T, c *util.DirCache, key string, size int) string {
+	t.Helper()
+	path, err := c.Put(key, func(dir string) error {
+		return os.WriteFile(filepath.Join(dir, "data"), make([]byte, size), 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestDirCacheEviction(t *testing.T) {
+	root := t.TempDir()
+	c, err := util.NewDirCache(root, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	putFile(t, c, "a", 100)
+	time.Sleep(10 * time.Millisecond)
+	putFile(t, c, "b", 100)
+	time.Sleep(10 * time.Millisecond)
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("a should be cached")
+	}
+	time.Sleep(10 * time.Millisecond)
+	putFile(t, c, "c", 100)
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b is the least recently used and should be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("%s should be cached", key)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "b")); !os.IsNotExist(err) {
+		t.Error("evicted entry should be removed from disk")
+	}
+
+	c, err = util.NewDirCache(root, 250)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get("c"); !ok {
+		t.Error("entries should survive a restart")
+	}
+	if _, err := c.Put("../x", func(string) error { return nil }); err == nil {
+		t.Error("invalid key should be rejected")
+	}
+}
+
+func TestCopyDir(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(src, "com", "example"), 0755)
+	os.WriteFile(filepath.Join(src, "main"), []byte("#!/bin/sh"), 0755)
+	os.WriteFile(filepath.Join(src, "com", "example", "Main.class"), []byte("class"), 0644)
+	os.Symlink("/etc/passwd", filepath.Join(src, "passwd"))
+	if err := util.CopyDir(src, dst); err != nil {
+		t.Fatal(err)
+	}
+	stat, err := os.Stat(filepath.Join(dst, "main"))
+	if err != nil || stat.Mode().Perm() != 0755 {
+		t.Errorf("executable should be copied with its permission: %v %v", stat, err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "com", "example", "Main.class")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "passwd")); !os.IsNotExist(err) {
+		t.Error("symlink should not be copied")
+	}
+}
+
+func TestDirCacheHold(t *testing.T) {
+	c, err := util.NewDirCache(t.TempDir(), 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := c.Hold("a"); ok {
+		t.Fatal("missing entry should not be held")
+	}
+	putFile(t, c, "a", 100)
+	path, release, ok := c.Hold("a")
+	if !ok {
+		t.Fatal("a should be held")
+	}
+	time.Sleep(10 * time.Millisecond)
+	putFile(t, c, "b", 100)
+	if _, err := os.Stat(path); err != nil {
+		t.Error("held entry should not be evicted")
+	}
+	release()
+	release()
+	if _, ok := c.Get("a"); ok {
+		t.Error("released entry over the limit should be evicted")
+	}
+	if _, ok := c.Get("b"); !ok {
+		t.Error("b should be cached")
+	}
+}
+
+func TestDirCacheHoldOrPut(t *testing.T) {
+	c, err := util.NewDirCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fills := 0
+	fill := func(dir string) error {
+		fills++
+		return os.WriteFile(filepath.Join(dir, "data"), []byte("x"), 0644)
+	}
+	for i := 0; i < 2; i++ {
+		path, release, err := c.HoldOrPut("a", fill)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = os.Stat(filepath.Join(path, "data")); err != nil {
+			t.Error(err)
+		}
+		release()
+	}
+	if fills != 1 {
+		t.Errorf("cached entry should be filled once, got %d", fills)
+	}
+	if _, _, err = c.HoldOrPut("b", func(string) error { return os.ErrInvalid }); err != os.ErrInvalid {
+		t.Errorf("fill error should be returned, got %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/goccy/go-json"
+)
+
+// ManifestEntry is a file relative to the problem folder, slash separated
+type ManifestEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type Manifest struct {
+	Files []ManifestEntry `json:"files"`
+}
+
+func ReadManifest(filePath string) (*Manifest, error) {
+	b, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ParseManifest(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Base(filePath), err)
+	}
+	return m, nil
+}
+
+func ParseManifest(b []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := json.Unmarshal(b, m); err != nil {
+		return nil, fmt.Errorf("%w: %s", config.ErrProblemData, err.Error())
+	}
+	seen := make(map[string]bool, 0)
+	for _, entry := range m.Files {
+		if CheckFileName(entry.Path) != nil || seen[entry.Path] {
+			return nil, fmt.Errorf("%w: invalid path %q in manifest", config.ErrProblemData, entry.Path)
+		}
+		seen[entry.Path] = true
+	}
+	m.sort()
+	return m, nil
+}
+
+// MakeManifest hashes files, their paths are relative to root
+func MakeManifest(root string, files []string) (*Manifest, error) {
+	m := &Manifest{Files: make([]ManifestEntry, 0, len(files))}
+	for _, name := range files {
+		filePath := filepath.Join(root, filepath.FromSlash(name))
+		stat, err := os.Stat(filePath)
+		if err != nil {
+			return nil, err
+		}
+		sum, err := FileSHA256(filePath)
+		if err != nil {
+			return nil, err
+		}
+		m.Files = append(m.Files, ManifestEntry{Path: name, Size: stat.Size(), SHA256: sum})
+	}
+	m.sort()
+	return m, nil
+}
+
+func (m *Manifest) sort() {
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+}
+
+func (m *Manifest) Contains(name string) bool {
+	i := sort.Search(len(m.Files), func(i int) bool {
+		return m.Files[i].Path >= name
+	})
+	return i < len(m.Files) && m.Files[i].Path == name
+}
+
+// Verify checks the size first, so a partial copy is found without reading it
+func (m *Manifest) Verify(root string) error {
+	for _, entry := range m.Files {
+		filePath := filepath.Join(root, filepath.FromSlash(entry.Path))
+		stat, err := os.Stat(filePath)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %s", config.ErrProblemData, entry.Path, err.Error())
+		}
+		if stat.Size() != entry.Size {
+			return fmt.Errorf("%w: %s: size is %d, want %d", config.ErrProblemData, entry.Path, stat.Size(), entry.Size)
+		}
+		sum, err := FileSHA256(filePath)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %s", config.ErrProblemData, entry.Path, err.Error())
+		}
+		if sum != entry.SHA256 {
+			return fmt.Errorf("%w: %s: checksum mismatch", config.ErrProblemData, entry.Path)
+		}
+	}
+	return nil
+}
+
+// Version is the SHA-256 of the entries in path order
+func (m *Manifest) Version() string {
+	h := sha256.New()
+	for _, entry := range m.Files {
+		fmt.Fprintf(h, "%s\x00%d\x00%s\n", entry.Path, entry.Size, entry.SHA256)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (m *Manifest) Write(filePath string) error {
+	b, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filePath, append(b, '\n'), 0644); err != nil {
+		return errors.New("cannot write manifest: " + err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package util_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+)
+
+func TestManifest(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "tests"), 0755)
+	os.WriteFile(filepath.Join(root, "tests", "1.in"), []byte("1 2\n"), 0644)
+	os.WriteFile(filepath.Join(root, "tests", "1.out"), []byte("3\n"), 0644)
+	m, err := util.MakeManifest(root, []string{"tests/1.out", "tests/1.in"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Files[0].Path != "tests/1.in" || m.Files[0].Size != 4 || !m.Contains("tests/1.out") || m.Contains("tests/2.in") {
+		t.Errorf("got manifest %+v", m)
+	}
+	manifestPath := filepath.Join(root, "manifest.json")
+	if err = m.Write(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	read, err := util.ReadManifest(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Version() != m.Version() || len(m.Version()) != 64 {
+		t.Errorf("version should survive a round trip: %s %s", read.Version(), m.Version())
+	}
+	if err = read.Verify(root); err != nil {
+		t.Fatal(err)
+	}
+
+	os.WriteFile(filepath.Join(root, "tests", "1.out"), []byte("3"), 0644)
+	if err = read.Verify(root); err == nil {
+		t.Error("truncated file should fail")
+	}
+	os.WriteFile(filepath.Join(root, "tests", "1.out"), []byte("4\n"), 0644)
+	if err = read.Verify(root); err == nil {
+		t.Error("changed file should fail")
+	}
+	os.WriteFile(manifestPath, []byte(`{"files": [{"path": "../secret", "size": 1, "sha256": ""}]}`), 0644)
+	if _, err = util.ReadManifest(manifestPath); err == nil {
+		t.Error("path outside the problem should be rejected")
+	}
+}
@@ -0,0 +1,192 @@
+package util
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+)
+
+// SourceWriter writes submitted files into Dir and remembers what it wrote.
+// Unlimited lifts the limits of submitted files, e.g. for problem data.
+type SourceWriter struct {
+	Dir       string
+	Files     []string
+	Unlimited bool
+	size      int64
+}
+
+// invalid is an error of the written files, the fault of the request or of
+// the problem data when Unlimited
+func (w *SourceWriter) invalid(format string, args ...interface{}) error {
+	kind := config.ErrInvalidRequest
+	if w.Unlimited {
+		kind = config.ErrProblemData
+	}
+	return fmt.Errorf("%w: %s", kind, fmt.Sprintf(format, args...))
+}
+
+// Files named twice, or both as a file and a folder, are invalid
+func (w *SourceWriter) fileError(name string, err error) error {
+	if errors.Is(err, fs.ErrExist) || errors.Is(err, syscall.ENOTDIR) {
+		return w.invalid("duplicate file %s", name)
+	}
+	return err
+}
+
+func (w *SourceWriter) localPath(name string) (string, error) {
+	if err := CheckFileName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(w.Dir, filepath.FromSlash(name)), nil
+}
+
+// Archivers usually store entries like "./src/" which is harmless
+func entryName(name string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(name, "./"), "/")
+}
+
+func (w *SourceWriter) Write(name string, r io.Reader) error {
+	if !w.Unlimited && len(w.Files) >= config.MaxSourceFiles {
+		return w.invalid("too many source files")
+	}
+	path, err := w.localPath(name)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		ErrorLog(err, "SourceWriter.Write(): mkdir")
+		return w.fileError(name, err)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		ErrorLog(err, "SourceWriter.Write(): create file")
+		return w.fileError(name, err)
+	}
+	defer f.Close()
+	w.Files = append(w.Files, name)
+	if w.Unlimited {
+		_, err = io.Copy(f, r)
+		if err != nil {
+			ErrorLog(err, "SourceWriter.Write(): write file")
+		}
+		return err
+	}
+	n, err := io.Copy(f, io.LimitReader(r, config.MaxSourceFileSize+1))
+	if err != nil {
+		ErrorLog(err, "SourceWriter.Write(): write file")
+		return err
+	}
+	if n > config.MaxSourceFileSize {
+		return w.invalid("source file %s is larger than %d bytes", name, config.MaxSourceFileSize)
+	}
+	w.size += n
+	if w.size > config.MaxSourceTotalSize {
+		return w.invalid("source files are larger than %d bytes in total", config.MaxSourceTotalSize)
+	}
+	return nil
+}
+
+func (w *SourceWriter) mkdir(name string) error {
+	if name == "" {
+		return nil
+	}
+	path, err := w.localPath(name)
+	if err != nil {
+		return err
+	}
+	return w.fileError(name, os.MkdirAll(path, 0755))
+}
+
+func (w *SourceWriter) Extract(archive model.ArchiveDescriptor) error {
+	content, err := base64.StdEncoding.DecodeString(archive.Content)
+	if err != nil {
+		return w.invalid("cannot decode archive: %s", err.Error())
+	}
+	switch archive.Format {
+	case model.ArchiveZip:
+		zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return w.invalid("cannot open zip archive: %s", err.Error())
+		}
+		return w.extractZip(zr)
+	case model.ArchiveTar:
+		return w.extractTar(bytes.NewReader(content))
+	case model.ArchiveTarGz:
+		gr, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return w.invalid("cannot decompress archive: %s", err.Error())
+		}
+		defer gr.Close()
+		return w.extractTar(gr)
+	}
+	return w.invalid("unknown archive format: %s", archive.Format)
+}
+
+func (w *SourceWriter) extractZip(zr *zip.Reader) error {
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			if err := w.mkdir(entryName(f.Name)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			return w.invalid("archive entry is not a regular file: %s", f.Name)
+		}
+		if !w.Unlimited && f.UncompressedSize64 > uint64(config.MaxSourceFileSize) {
+			return w.invalid("source file %s is larger than %d bytes", f.Name, config.MaxSourceFileSize)
+		}
+		r, err := f.Open()
+		if err != nil {
+			return w.invalid("cannot read archive entry: %s", err.Error())
+		}
+		err = w.Write(entryName(f.Name), r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *SourceWriter) extractTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return w.invalid("cannot read tar archive: %s", err.Error())
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = w.mkdir(entryName(hdr.Name))
+		case tar.TypeReg:
+			if !w.Unlimited && hdr.Size > config.MaxSourceFileSize {
+				return w.invalid("source file %s is larger than %d bytes", hdr.Name, config.MaxSourceFileSize)
+			}
+			err = w.Write(entryName(hdr.Name), tr)
+		case tar.TypeXGlobalHeader:
+		default:
+			err = w.invalid("archive entry is not a regular file: %s", hdr.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package util_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+)
+
+func zipArchive(t *testing.T, files map[string]string, symlink string) model.ArchiveDescriptor {
+	buf := bytes.Buffer{}
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if symlink != "" {
+		hdr := &zip.FileHeader{Name: symlink}
+		hdr.SetMode(os.ModeSymlink | 0777)
+		f, err := zw.CreateHeader(hdr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte("/etc/passwd"))
+	}
+	zw.Close()
+	return model.ArchiveDescriptor{
+		Format:  model.ArchiveZip,
+		Content: base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}
+}
+
+func tarArchive(t *testing.T, hdrs []*tar.Header) model.ArchiveDescriptor {
+	buf := bytes.Buffer{}
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range hdrs {
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(bytes.Repeat([]byte{'a'}, int(hdr.Size)))
+	}
+	tw.Close()
+	return model.ArchiveDescriptor{
+		Format:  model.ArchiveTar,
+		Content: base64.StdEncoding.EncodeToString(buf.Bytes()),
+	}
+}
+
+func TestSourceWriterWrite(t *testing.T) {
+	w := util.SourceWriter{Dir: t.TempDir()}
+	if err := w.Write("src/main.cpp", strings.NewReader("int main(){}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(w.Dir, "src", "main.cpp")); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"", "../main.cpp", "/etc/passwd", "src/../../main.cpp"} {
+		if err := w.Write(name, strings.NewReader("")); !errors.Is(err, config.ErrInvalidRequest) {
+			t.Errorf("name %q should be rejected", name)
+		}
+	}
+	big := strings.NewReader(strings.Repeat("a", int(config.MaxSourceFileSize)+1))
+	if err := w.Write("big.cpp", big); !errors.Is(err, config.ErrInvalidRequest) {
+		t.Error("oversized file should be rejected")
+	}
+	if err := w.Write("src/main.cpp/a.h", strings.NewReader("")); !errors.Is(err, config.ErrInvalidRequest) {
+		t.Errorf("file under a file should be rejected: %v", err)
+	}
+}
+
+func TestSourceWriterExtractZip(t *testing.T) {
+	w := util.SourceWriter{Dir: t.TempDir()}
+	err := w.Extract(zipArchive(t, map[string]string{"a.h": "a", "pkg/Main.java": "b"}, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(w.Files) != 2 {
+		t.Fatalf("expected 2 files, got %v", w.Files)
+	}
+
+	w = util.SourceWriter{Dir: t.TempDir()}
+	if err := w.Extract(zipArchive(t, map[string]string{"../evil": "a"}, "")); !errors.Is(err, config.ErrInvalidRequest) {
+		t.Error("zip slip should be rejected")
+	}
+	w = util.SourceWriter{Dir: t.TempDir()}
+	if err := w.Extract(zipArchive(t, nil, "link")); !errors.Is(err, config.ErrInvalidRequest) {
+		t.Error("symlink should be rejected")
+	}
+	w = util.SourceWriter{Dir: t.TempDir()}
+	if err := w.Extract(model.ArchiveDescriptor{Format: model.ArchiveZip, Content: "not base64!"}); !errors.Is(err, config.ErrInvalidRequest) {
+		t.Errorf("bad base64 should be rejected: %v", err)
+	}
+}
+
+func TestSourceWriterExtractTar(t *testing.T) {
+	w := util.SourceWriter{Dir: t.TempDir()}
+	err := w.Extract(tarArchive(t, []*tar.Header{
+		{Name: "src/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "src/main.c", Typeflag: tar.TypeReg, Mode: 0644, Size: 4},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hostile := [][]*tar.Header{
+		{{Name: "../../evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}},
+		{{Name: "/tmp/evil", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}},
+		{{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc"}},
+		{{Name: "hard", Typeflag: tar.TypeLink, Linkname: "/etc/passwd"}},
+		{{Name: "big", Typeflag: tar.TypeReg, Mode: 0644, Size: config.MaxSourceFileSize + 1}},
+		{{Name: "a", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}, {Name: "a", Typeflag: tar.TypeReg, Mode: 0644, Size: 1}},
+	}
+	for _, hdrs := range hostile {
+		w := util.SourceWriter{Dir: t.TempDir()}
+		if err := w.Extract(tarArchive(t, hdrs)); !errors.Is(err, config.ErrInvalidRequest) {
+			t.Errorf("entry %q should be rejected", hdrs[0].Name)
+		}
+	}
+}
@@ -1,8 +1,9 @@
 package util
 
 import (
-	"bufio"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
@@ -19,6 +20,14 @@ import (
 
 const sigma = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
 
+// Messages of responses whose ErrCode is OK
+const (
+	MsgSuccess     = "success"
+	MsgRunning     = "running"
+	MsgWrongAnswer = "wrong answer"
+	MsgNoOutput    = "output file not found"
+)
+
 func GetWallTimeLimit(limit int64) time.Duration {
 	timeWithRedundancy := limit + 100
 	return time.Duration(timeWithRedundancy) * time.Millisecond
@@ -53,13 +62,18 @@ func Mkdir(parent string) (string, string, error) {
 	return wdName, wdPathName, nil
 }
 
-func LimitFileReader(filePath string) (*model.OmitString, error) {
+func LimitFileReader(filePath string, limit int64) (*model.OmitString, error) {
 	f, err := os.Open(filePath)
 	if err != nil {
 		ErrorLog(err, "LimitFileReader(): open file")
 		return nil, err
 	}
 	defer f.Close()
+	return LimitReader(f, limit)
+}
+
+// LimitReader reads at most limit bytes from an opened file
+func LimitReader(f *os.File, limit int64) (*model.OmitString, error) {
 	stat, err := f.Stat()
 	if err != nil {
 		ErrorLog(err, "LimitFileReader(): get file status")
@@ -69,28 +83,32 @@ func LimitFileReader(filePath string) (*model.OmitString, error) {
 	if allSize == 0 {
 		return nil, nil
 	}
-	readSize := config.OmitStringLen
+	readSize := limit
 	if allSize < readSize {
 		readSize = allSize
 	}
 	buf := make([]byte, readSize)
-	bufReader := bufio.NewReader(f)
-	n, err := bufReader.Read(buf)
+	_, err = io.ReadFull(f, buf)
 	if err != nil {
 		ErrorLog(err, "LimitFileReader(): read file")
 		return nil, err
 	}
-	if int64(n) != readSize {
-		err := errors.New("exact read length not equal to the expected")
-		ErrorLog(err, "LimitFileReader(): read file")
-		return nil, err
-	}
 	return &model.OmitString{
 		S:        string(buf),
 		OmitSize: allSize - readSize,
 	}, nil
 }
 
+func TruncateOmitString(s *model.OmitString, limit int64) *model.OmitString {
+	if s == nil || int64(len(s.S)) <= limit {
+		return s
+	}
+	return &model.OmitString{
+		S:        s.S[:limit],
+		OmitSize: s.OmitSize + int64(len(s.S)) - limit,
+	}
+}
+
 func SafeCopy(src string, dst string) error {
 	os.Remove(dst)
 	sourceFileStat, err := os.Stat(src)
@@ -125,6 +143,43 @@ func SafeCopy(src string, dst string) error {
 	return err
 }
 
+// HashKey returns the hex encoded SHA-256 of v in JSON, used as a cache key
+func HashKey(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// FileSHA256 returns the hex encoded SHA-256 of a file
+func FileSHA256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		ErrorLog(err, "FileSHA256(): open file")
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		ErrorLog(err, "FileSHA256(): read file")
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// An absent compile phase means the sources are run as they are
+func CompileSteps(phase model.CompilePhase) []model.Phase {
+	if len(phase.Steps) != 0 {
+		return phase.Steps
+	}
+	if phase.Compile == nil {
+		return nil
+	}
+	return []model.Phase{*phase.Compile}
+}
+
 func MakePublishing(resp model.Response, corId string) amqp091.Publishing {
 	bd, err := json.Marshal(resp)
 	if err != nil {
@@ -146,14 +201,50 @@ func InternalError(err error, corId string) amqp091.Publishing {
 	return MakePublishing(resp, corId)
 }
 
-func CompileError(msg *model.OmitString, corId string) amqp091.Publishing {
-	msgStr, err := json.Marshal(msg)
+func BadRequest(errs []model.FieldError, corId string) amqp091.Publishing {
+	errsStr, err := json.Marshal(errs)
+	if err != nil {
+		panic(err)
+	}
+	resp := model.Response{
+		ErrCode: model.BR,
+		ErrMsg:  config.ErrInvalidRequest.Error(),
+		Data:    string(errsStr),
+	}
+	return MakePublishing(resp, corId)
+}
+
+// MakeCompileLog returns nil when there is nothing to report
+func MakeCompileLog(res *model.CompileResult) *model.CompileLog {
+	if res.ErrMsg == nil && res.Time == 0 && res.Reason == "" {
+		return nil
+	}
+	return &model.CompileLog{
+		OmitString:  res.ErrMsg,
+		Step:        res.Step,
+		Reason:      res.Reason,
+		Time:        res.Time,
+		Memory:      res.Memory,
+		Diagnostics: res.Diagnostics,
+	}
+}
+
+func CompileError(res *model.CompileResult, corId string) amqp091.Publishing {
+	compileLog := MakeCompileLog(res)
+	if compileLog == nil {
+		compileLog = &model.CompileLog{Step: res.Step}
+	}
+	msgStr, err := json.Marshal(compileLog)
 	if err != nil {
 		panic(err)
 	}
+	errMsg := "compile error"
+	if res.Reason != "" {
+		errMsg = res.Reason
+	}
 	resp := model.Response{
 		ErrCode: model.CE,
-		ErrMsg:  "compile error",
+		ErrMsg:  errMsg,
 		Data:    string(msgStr),
 	}
 	return MakePublishing(resp, corId)
@@ -182,7 +273,7 @@ func OKResp(resp model.ExecResult, corId string) amqp091.Publishing {
 	}
 	rep := model.Response{
 		ErrCode: model.OK,
-		ErrMsg:  "success",
+		ErrMsg:  MsgSuccess,
 		Data:    string(resStr),
 	}
 	return MakePublishing(rep, corId)
@@ -192,7 +283,7 @@ func RunningResp(cas int, corId string) amqp091.Publishing {
 	casStr := fmt.Sprintf("%d", cas)
 	rep := model.Response{
 		ErrCode: model.OK,
-		ErrMsg:  "running",
+		ErrMsg:  MsgRunning,
 		Data:    casStr,
 	}
 	return MakePublishing(rep, corId)
@@ -205,7 +296,21 @@ func WAResp(resp model.ExecResult, corId string) amqp091.Publishing {
 	}
 	rep := model.Response{
 		ErrCode: model.OK,
-		ErrMsg:  "wrong answer",
+		ErrMsg:  MsgWrongAnswer,
+		Data:    string(resStr),
+	}
+	return MakePublishing(rep, corId)
+}
+
+// NoOutputResp is for a program that did not write its output file
+func NoOutputResp(resp model.ExecResult, corId string) amqp091.Publishing {
+	resStr, err := json.Marshal(resp)
+	if err != nil {
+		panic(err)
+	}
+	rep := model.Response{
+		ErrCode: model.OK,
+		ErrMsg:  MsgNoOutput,
 		Data:    string(resStr),
 	}
 	return MakePublishing(rep, corId)
@@ -0,0 +1,78 @@
+package util_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+	"github.com/goccy/go-json"
+)
+
+func TestCompileError(t *testing.T) {
+	res := &model.CompileResult{
+		Step:   2,
+		ErrMsg: &model.OmitString{S: "error: expected ';'", OmitSize: 3},
+	}
+	pub := util.CompileError(res, "1")
+	resp := model.Response{}
+	if err := json.Unmarshal(pub.Body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ErrCode != model.CE {
+		t.Fatalf("expected CE, got %d", resp.ErrCode)
+	}
+	want := `{"s":"error: expected ';'","omit_size":3,"step":2,"time":0,"memory":0}`
+	if resp.Data != want {
+		t.Errorf("expected %s, got %s", want, resp.Data)
+	}
+
+	res = &model.CompileResult{Step: 1, Reason: model.CompileReasonTLE, Time: 1e10, Memory: 1024}
+	resp = model.Response{}
+	if err := json.Unmarshal(util.CompileError(res, "1").Body, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.ErrMsg != model.CompileReasonTLE {
+		t.Errorf("expected %s, got %s", model.CompileReasonTLE, resp.ErrMsg)
+	}
+	want = `{"step":1,"reason":"compilation time limit","time":10000000000,"memory":1024}`
+	if resp.Data != want {
+		t.Errorf("expected %s, got %s", want, resp.Data)
+	}
+}
+
+func TestLimitFileReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "log")
+	if err := os.WriteFile(path, []byte("warning: unused variable"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	res, err := util.LimitFileReader(path, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.S != "warning" || res.OmitSize != 17 {
+		t.Errorf("unexpected result %+v", res)
+	}
+	res, err = util.LimitFileReader(path, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.S != "warning: unused variable" || res.OmitSize != 0 {
+		t.Errorf("unexpected result %+v", res)
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	type key struct {
+		Path    string
+		ModTime int64
+	}
+	a := util.HashKey(key{"in", 1})
+	if len(a) != 64 || a != util.HashKey(key{"in", 1}) {
+		t.Errorf("key should be a stable hex SHA-256, got %q", a)
+	}
+	if a == util.HashKey(key{"in", 2}) {
+		t.Error("key should change with the value")
+	}
+}
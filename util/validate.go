@@ -0,0 +1,241 @@
+package util
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/diag"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+)
+
+func validComponent(s string, glob bool) bool {
+	if s == "" || len(s) > config.MaxFileNameLen || s[0] == '.' || s[0] == '-' {
+		return false
+	}
+	for _, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == '-', c == '+':
+		case glob && (c == '*' || c == '?' || c == '[' || c == ']'):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CheckFileName accepts relative slash separated paths which stay inside the work directory
+func CheckFileName(name string) error {
+	if len(name) > config.MaxPathLen {
+		return fmt.Errorf("%w: file name is too long", config.ErrInvalidRequest)
+	}
+	for _, component := range strings.Split(name, "/") {
+		if !validComponent(component, false) {
+			return fmt.Errorf("%w: invalid file name %q", config.ErrInvalidRequest, name)
+		}
+	}
+	return nil
+}
+
+// CheckPattern is CheckFileName for glob patterns
+func CheckPattern(pattern string) error {
+	if len(pattern) > config.MaxPathLen {
+		return fmt.Errorf("%w: pattern is too long", config.ErrInvalidRequest)
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("%w: invalid pattern %q", config.ErrInvalidRequest, pattern)
+	}
+	for _, component := range strings.Split(pattern, "/") {
+		if !validComponent(component, true) {
+			return fmt.Errorf("%w: invalid pattern %q", config.ErrInvalidRequest, pattern)
+		}
+	}
+	return nil
+}
+
+// CheckProblemID accepts a single path component
+func CheckProblemID(problemID string) error {
+	if !validComponent(problemID, false) {
+		return fmt.Errorf("%w: invalid problem ID %q", config.ErrInvalidRequest, problemID)
+	}
+	return nil
+}
+
+// CheckFileIO requires plain file names, at least one of them
+func CheckFileIO(fileIO model.FileIO) error {
+	if fileIO.Input == "" && fileIO.Output == "" {
+		return errors.New("input or output must be set")
+	}
+	for _, name := range []string{fileIO.Input, fileIO.Output} {
+		if name != "" && !validComponent(name, false) {
+			return fmt.Errorf("invalid file name %q", name)
+		}
+	}
+	if fileIO.Input == fileIO.Output {
+		return errors.New("input and output must differ")
+	}
+	return nil
+}
+
+type requestValidator struct {
+	errs []model.FieldError
+}
+
+func (v *requestValidator) add(field string, format string, args ...interface{}) {
+	v.errs = append(v.errs, model.FieldError{
+		Field: field,
+		Msg:   fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *requestValidator) fileName(field string, name string) {
+	if name == "" {
+		v.add(field, "must not be empty")
+		return
+	}
+	if CheckFileName(name) != nil {
+		v.add(field, "invalid file name %q", name)
+	}
+}
+
+func (v *requestValidator) phase(field string, phase model.Phase) {
+	v.command(field, phase)
+	v.limits(field+".limits", phase.Limits, false)
+}
+
+func (v *requestValidator) command(field string, phase model.Phase) {
+	if len(phase.RunArgs) == 0 {
+		v.add(field+".run_args", "must not be empty")
+	}
+	if phase.Diagnostics != "" && !diag.Known(phase.Diagnostics) {
+		v.add(field+".diagnostics", "unknown diagnostics format %q", phase.Diagnostics)
+	}
+}
+
+// limits of 0 are allowed when unset is true, they are filled in later
+func (v *requestValidator) limits(field string, limits model.Limitation, unset bool) {
+	if limits.Time < 0 || limits.Time == 0 && !unset {
+		v.add(field+".time", "must be positive")
+	} else if limits.Time > config.MaxTimeLimit {
+		v.add(field+".time", "must not exceed %d", config.MaxTimeLimit)
+	}
+	if limits.Memory < 0 || limits.Memory == 0 && !unset {
+		v.add(field+".mem", "must be positive")
+	} else if limits.Memory > config.MaxMemoryLimit {
+		v.add(field+".mem", "must not exceed %d", config.MaxMemoryLimit)
+	}
+	if limits.Stack != nil {
+		if *limits.Stack <= 0 {
+			v.add(field+".stack", "must be positive")
+		} else if *limits.Stack > config.MaxMemoryLimit {
+			v.add(field+".stack", "must not exceed %d", config.MaxMemoryLimit)
+		}
+	}
+}
+
+func (v *requestValidator) source(field string, fileDesc model.SourceCodeDescriptor, names map[string]bool) {
+	v.fileName(field+".name", fileDesc.Name)
+	if names[fileDesc.Name] {
+		v.add(field+".name", "duplicate file name %q", fileDesc.Name)
+	}
+	names[fileDesc.Name] = true
+	if int64(len(fileDesc.Content)) > config.MaxSourceFileSize {
+		v.add(field+".content", "must not be larger than %d bytes", config.MaxSourceFileSize)
+	}
+}
+
+func (v *requestValidator) compilePhase(field string, phase model.CompilePhase) {
+	if len(phase.Steps) == 0 && phase.Compile != nil {
+		v.phase(field+".compile", *phase.Compile)
+	} else if phase.Compile != nil {
+		v.add(field+".compile", "must not be set together with steps")
+	}
+	if len(phase.Steps) > config.MaxCompileSteps {
+		v.add(field+".steps", "must not contain more than %d steps", config.MaxCompileSteps)
+	}
+	for i, step := range phase.Steps {
+		v.phase(fmt.Sprintf("%s.steps[%d]", field, i), step)
+	}
+	if phase.SyntaxCheck != nil {
+		v.phase(field+".syntax_check", *phase.SyntaxCheck)
+	}
+	names := make(map[string]bool, 0)
+	if phase.SourceCode.Name != "" || phase.SourceCode.Content != "" {
+		v.source(field+".code", phase.SourceCode, names)
+	}
+	for i, fileDesc := range phase.SourceCodes {
+		v.source(fmt.Sprintf("%s.codes[%d]", field, i), fileDesc, names)
+	}
+	if len(names) > config.MaxSourceFiles {
+		v.add(field+".codes", "must not contain more than %d files", config.MaxSourceFiles)
+	}
+	if archive := phase.Archive; archive != nil {
+		switch archive.Format {
+		case model.ArchiveZip, model.ArchiveTar, model.ArchiveTarGz:
+		default:
+			v.add(field+".archive.format", "unknown archive format %q", archive.Format)
+		}
+		if int64(base64.StdEncoding.DecodedLen(len(archive.Content))) > config.MaxSourceTotalSize {
+			v.add(field+".archive.content", "must not be larger than %d bytes", config.MaxSourceTotalSize)
+		}
+	} else if len(names) == 0 {
+		v.add(field+".code", "no source file")
+	}
+	if phase.ExecName != "" || (len(CompileSteps(phase)) != 0 && len(phase.Artifacts) == 0) {
+		v.fileName(field+".exec_name", phase.ExecName)
+	}
+	if phase.LogLimit < 0 || phase.LogLimit > config.MaxLogLimit {
+		v.add(field+".log_limit", "must be between 0 and %d", config.MaxLogLimit)
+	}
+	for i, pattern := range phase.Artifacts {
+		if CheckPattern(pattern) != nil {
+			v.add(fmt.Sprintf("%s.artifacts[%d]", field, i), "invalid pattern %q", pattern)
+		}
+	}
+}
+
+// ValidateRequest reports every violation in the request, nil means it is well formed
+func ValidateRequest(req *model.ExecRequest) []model.FieldError {
+	v := requestValidator{}
+	v.compilePhase("compile_phases", req.CompilePhases)
+	// limits of 0 of the run phase are those of the problem, see ValidateRunLimits
+	v.command("run_phases.run", req.RunPhases.Run)
+	v.limits("run_phases.run.limits", req.RunPhases.Run.Limits, true)
+	if req.RunPhases.ProblemID == "" {
+		v.add("run_phases.pid", "must not be empty")
+	} else if CheckProblemID(req.RunPhases.ProblemID) != nil {
+		v.add("run_phases.pid", "invalid problem ID %q", req.RunPhases.ProblemID)
+	}
+	if version := req.RunPhases.DataVersion; version != "" {
+		if _, err := hex.DecodeString(version); err != nil || len(version) != 64 {
+			v.add("run_phases.data_version", "must be a hex encoded SHA-256")
+		}
+	}
+	if req.RunPhases.FileIO != nil {
+		if err := CheckFileIO(*req.RunPhases.FileIO); err != nil {
+			v.add("run_phases.file_io", "%s", err.Error())
+		}
+	}
+	switch req.CheckPhase {
+	case config.CheckMethodWcmp, config.CheckMethodSpj:
+	default:
+		v.add("check_phase", "unknown check method %q", req.CheckPhase)
+	}
+	if req.CheckLogLimit < 0 || req.CheckLogLimit > config.MaxLogLimit {
+		v.add("check_log_limit", "must be between 0 and %d", config.MaxLogLimit)
+	}
+	return v.errs
+}
+
+// ValidateRunLimits reports violations of the run limits after the limits of
+// the problem are filled in
+func ValidateRunLimits(limits model.Limitation) []model.FieldError {
+	v := requestValidator{}
+	v.limits("run_phases.run.limits", limits, false)
+	return v.errs
+}
@@ -0,0 +1,200 @@
+package util_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/HeRaNO/cdoj-execution-worker/config"
+	"github.com/HeRaNO/cdoj-execution-worker/model"
+	"github.com/HeRaNO/cdoj-execution-worker/util"
+)
+
+func TestCheckFileName(t *testing.T) {
+	for _, name := range []string{"main.cpp", "Main.java", "com/example/Main.java", "a_b-c+d.h"} {
+		if err := util.CheckFileName(name); err != nil {
+			t.Errorf("name %q should be accepted: %s", name, err)
+		}
+	}
+	hostile := []string{
+		"", ".", "..", "../../x", "a/../../x", "/etc/passwd", "a//b", "a/", "./a",
+		".hidden", "-o", "a\\..\\b", "a b", "a\x00b", "main.cpp\n", strings.Repeat("a", 256),
+	}
+	for _, name := range hostile {
+		err := util.CheckFileName(name)
+		if !errors.Is(err, config.ErrInvalidRequest) {
+			t.Errorf("name %q should be rejected, got %v", name, err)
+		}
+	}
+}
+
+func TestCheckProblemID(t *testing.T) {
+	for _, id := range []string{"1", "1001", "abc_1"} {
+		if err := util.CheckProblemID(id); err != nil {
+			t.Errorf("problem ID %q should be accepted: %s", id, err)
+		}
+	}
+	for _, id := range []string{"", ".", "..", "../..", "1/2", "/1", "1\x00"} {
+		if err := util.CheckProblemID(id); !errors.Is(err, config.ErrInvalidRequest) {
+			t.Errorf("problem ID %q should be rejected, got %v", id, err)
+		}
+	}
+}
+
+func validRequest() model.ExecRequest {
+	config.MaxTimeLimit = config.DefaultMaxTimeLimit
+	config.MaxMemoryLimit = config.DefaultMaxMemoryLimit
+	return model.ExecRequest{
+		CompilePhases: model.CompilePhase{
+			Compile: &model.Phase{
+				RunArgs: []string{"g++", "main.cpp", "-o", "main"},
+				Limits:  model.Limitation{Time: 10000, Memory: 1024 << 20},
+			},
+			SourceCode: model.SourceCodeDescriptor{Name: "main.cpp", Content: "int main(){}"},
+			ExecName:   "main",
+		},
+		RunPhases: model.RunPhase{
+			Run: model.Phase{
+				RunArgs: []string{"./main"},
+				Limits:  model.Limitation{Time: 1000, Memory: 256 << 20},
+			},
+			ProblemID: "1",
+		},
+		CheckPhase: config.CheckMethodWcmp,
+	}
+}
+
+func fields(errs []model.FieldError) []string {
+	res := make([]string, 0)
+	for _, e := range errs {
+		res = append(res, e.Field)
+	}
+	return res
+}
+
+func TestValidateRequest(t *testing.T) {
+	req := validRequest()
+	if errs := util.ValidateRequest(&req); len(errs) != 0 {
+		t.Fatalf("valid request rejected: %+v", errs)
+	}
+
+	stack := int64(-1)
+	req.CompilePhases.Compile.RunArgs = nil
+	req.CompilePhases.Compile.Diagnostics = "brainfuck"
+	req.CompilePhases.ExecName = ""
+	req.RunPhases.Run.Limits = model.Limitation{Time: -1, Memory: config.MaxMemoryLimit + 1, Stack: &stack}
+	req.CheckPhase = "magic"
+	req.CheckLogLimit = -1
+	want := []string{
+		"compile_phases.compile.run_args",
+		"compile_phases.compile.diagnostics",
+		"compile_phases.exec_name",
+		"run_phases.run.limits.time",
+		"run_phases.run.limits.mem",
+		"run_phases.run.limits.stack",
+		"check_phase",
+		"check_log_limit",
+	}
+	got := fields(util.ValidateRequest(&req))
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("expected violations %v, got %v", want, got)
+	}
+}
+
+func TestValidateRequestPaths(t *testing.T) {
+	cases := []struct {
+		field string
+		set   func(req *model.ExecRequest)
+	}{
+		{"compile_phases.code.name", func(req *model.ExecRequest) { req.CompilePhases.SourceCode.Name = "../../x" }},
+		{"compile_phases.codes[0].name", func(req *model.ExecRequest) {
+			req.CompilePhases.SourceCodes = []model.SourceCodeDescriptor{{Name: "/tmp/x"}}
+		}},
+		{"compile_phases.codes[0].name", func(req *model.ExecRequest) {
+			req.CompilePhases.SourceCodes = []model.SourceCodeDescriptor{{Name: "main.cpp"}}
+		}},
+		{"compile_phases.exec_name", func(req *model.ExecRequest) { req.CompilePhases.ExecName = "../main" }},
+		{"run_phases.pid", func(req *model.ExecRequest) { req.RunPhases.ProblemID = "../.." }},
+		{"run_phases.data_version", func(req *model.ExecRequest) { req.RunPhases.DataVersion = "v1" }},
+		{"run_phases.file_io", func(req *model.ExecRequest) { req.RunPhases.FileIO = &model.FileIO{Input: "../a.in"} }},
+		{"run_phases.file_io", func(req *model.ExecRequest) { req.RunPhases.FileIO = &model.FileIO{Input: "a", Output: "a"} }},
+		{"run_phases.file_io", func(req *model.ExecRequest) { req.RunPhases.FileIO = &model.FileIO{} }},
+	}
+	for _, c := range cases {
+		req := validRequest()
+		c.set(&req)
+		got := fields(util.ValidateRequest(&req))
+		if len(got) != 1 || got[0] != c.field {
+			t.Errorf("expected a violation of %s, got %v", c.field, got)
+		}
+	}
+}
+
+func TestValidateRequestSteps(t *testing.T) {
+	req := validRequest()
+	step := *req.CompilePhases.Compile
+	req.CompilePhases.Compile = nil
+	req.CompilePhases.Steps = []model.Phase{step, {RunArgs: []string{"jar"}}}
+	want := []string{"compile_phases.steps[1].limits.time", "compile_phases.steps[1].limits.mem"}
+	got := fields(util.ValidateRequest(&req))
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("expected violations %v, got %v", want, got)
+	}
+
+	req = validRequest()
+	req.CompilePhases.Steps = []model.Phase{*req.CompilePhases.Compile}
+	got = fields(util.ValidateRequest(&req))
+	if len(got) != 1 || got[0] != "compile_phases.compile" {
+		t.Errorf("compile with steps should be a violation of compile_phases.compile, got %v", got)
+	}
+}
+
+func TestValidateRequestWithoutCompile(t *testing.T) {
+	req := validRequest()
+	req.CompilePhases.Compile = &model.Phase{}
+	got := fields(util.ValidateRequest(&req))
+	if len(got) == 0 || got[0] != "compile_phases.compile.run_args" {
+		t.Errorf("an empty compile phase should be validated, got %v", got)
+	}
+	req.CompilePhases.Compile = nil
+	req.CompilePhases.ExecName = ""
+	req.CompilePhases.SourceCode.Name = "main.py"
+	if errs := util.ValidateRequest(&req); len(errs) != 0 {
+		t.Fatalf("request without compile phase rejected: %+v", errs)
+	}
+	req.CompilePhases.SyntaxCheck = &model.Phase{RunArgs: []string{"python3", "-m", "py_compile", "main.py"}}
+	got = fields(util.ValidateRequest(&req))
+	want := []string{"compile_phases.syntax_check.limits.time", "compile_phases.syntax_check.limits.mem"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("expected violations %v, got %v", want, got)
+	}
+}
+
+func TestValidateRequestArtifacts(t *testing.T) {
+	req := validRequest()
+	req.CompilePhases.ExecName = ""
+	req.CompilePhases.Artifacts = []string{"*.class", "com/example/*.class"}
+	if errs := util.ValidateRequest(&req); len(errs) != 0 {
+		t.Fatalf("valid artifacts rejected: %+v", errs)
+	}
+	for _, pattern := range []string{"../*.class", "/*", "[", "a/../../*", ".*"} {
+		req.CompilePhases.Artifacts = []string{pattern}
+		got := fields(util.ValidateRequest(&req))
+		if len(got) != 1 || got[0] != "compile_phases.artifacts[0]" {
+			t.Errorf("pattern %q should be rejected, got %v", pattern, got)
+		}
+	}
+}
+
+func TestValidateRunLimits(t *testing.T) {
+	req := validRequest()
+	req.RunPhases.Run.Limits = model.Limitation{}
+	if errs := util.ValidateRequest(&req); len(errs) != 0 {
+		t.Fatalf("request without run limits rejected: %+v", errs)
+	}
+	want := []string{"run_phases.run.limits.time", "run_phases.run.limits.mem"}
+	got := fields(util.ValidateRunLimits(req.RunPhases.Run.Limits))
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("expected violations %v, got %v", want, got)
+	}
+}